@@ -5,7 +5,9 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
 	"core/algorithm"
+	"core/chaincfg"
 	"core/transaction"
 	"encoding/gob"
 	"fmt"
@@ -23,28 +25,43 @@ type Block struct {
 	Bits int32
 	Nonce int32
 	Height int32
+	Signature []byte  // 权威证明共识下权威节点对区块Hash的签名, 不参与区块Hash的计算
 	Transactions []*transaction.Transaction
 }
 
-// 创世区块函数
-func NewGensisBlock(transactions []*transaction.Transaction) *Block {
+// 根据网络参数构建创世区块, 同一网络的创世区块完全相同
+func NewGensisBlock(params *chaincfg.Params) *Block {
+	// 创世区块的coinbase交易
+	coinbase := transaction.NewCoinBaseTx(params.GenesisAddress, params.GenesisData, transaction.GetBlockSubsidy(params, 0))
+	transactions := []*transaction.Transaction{coinbase}
+
 	// 初始化区块
 	block := &Block{
 		Version:       2,
 		PrevBlockHash: []byte{},
 		MerkleRoot:    []byte{},
 		Hash:          []byte{},
-		Time:          int32(time.Now().Unix()),
-		Bits:          404454260,
+		Time:          params.GenesisTime,
+		Bits:          params.PowLimitBits,
 		Nonce:         0,
 		Height:        0,
 		Transactions:  transactions,
 	}
 
-	// 工作量证明
-	pow := NewProofOfWork(block)
+	// 计算默克尔根, 使区块头的hash值包含所有交易
+	block.CreateMerkleTreeRoot(transactions)
+
+	// 工作量证明, 使用单个协程挖矿, 保证每次找到的都是最小的满足难度的随机数
+	powHash, err := NewPowHashFunc(params)
+	if err != nil {
+		log.Panic(err)
+	}
+	pow := NewProofOfWorkWithHash(block, powHash)
 	// 开始挖矿, 并返回当前区块的随机数Nonce和Hash值
-	nonce, hash := pow.Mine()
+	nonce, hash, err := pow.MineWithContext(context.Background(), 1)
+	if err != nil {
+		log.Panic(err)
+	}
 	block.Nonce = nonce
 	block.Hash = hash
 
@@ -53,37 +70,120 @@ func NewGensisBlock(transactions []*transaction.Transaction) *Block {
 	return block
 }
 
-func NewBlock(transactions []*transaction.Transaction, prevBlockHash []byte, height int32) *Block {
+// 根据交易、前一区块Hash、高度和难度值构建新区块, 并通过共识引擎封装区块
+func NewBlock(engine ConsensusEngine, transactions []*transaction.Transaction, prevBlockHash []byte, height int32, bits int32) *Block {
+	block := newBlockTemplate(transactions, prevBlockHash, height, bits)
+
+	// 通过共识引擎封装区块(工作量证明为挖矿, 权威证明为签名), 计算当前区块的Hash值
+	err := engine.Seal(context.Background(), block)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return block
+}
+
+// 构建尚未挖矿的区块
+func newBlockTemplate(transactions []*transaction.Transaction, prevBlockHash []byte, height int32, bits int32) *Block {
 	block := &Block{
 		Version:       2,
 		PrevBlockHash: prevBlockHash,
 		MerkleRoot:    []byte{},
 		Hash:          []byte{},
 		Time:          int32(time.Now().Unix()),
-		Bits:          404454260,
+		Bits:          bits,
 		Nonce:         0,
 		Height:        height,
 		Transactions:  transactions,
 	}
 
-	// 工作量证明
-	pow := NewProofOfWork(block)
-	// 开始挖矿, 并返回当前区块的随机数Nonce和Hash值
-	nonce, hash := pow.Mine()
-	block.Nonce = nonce
-	block.Hash = hash
+	// 计算默克尔根, 使区块头的hash值包含所有交易
+	block.CreateMerkleTreeRoot(transactions)
 	return block
 }
 
+// 计算区块头的Hash值
+func (block *Block) HeaderHash() []byte {
+	return NewProofOfWork(block).Hash()
+}
+
+// 通过工作量证明对区块挖矿, 挖矿成功后更新区块的随机数Nonce和Hash值, 可通过上下文取消挖矿
+func (block *Block) Mine(ctx context.Context, powHash PowHashFunc) error {
+	// 记录coinbase交易输入中原始的数据, 额外随机数拼接在其后面
+	var coinbaseData []byte
+	if block.hasCoinbase() {
+		coinbaseData = append([]byte{}, block.Transactions[0].Vin[0].ScriptSig...)
+	}
+
+	var extraNonce uint64
+	for {
+		pow := NewProofOfWorkWithHash(block, powHash)
+		nonce, hash, err := pow.MineWithContext(ctx, MinerThreads)
+		if err == nil {
+			block.Nonce = nonce
+			block.Hash = hash
+			return nil
+		}
+
+		if err != ErrNonceExhausted {
+			return err
+		}
+
+		// 32位随机数空间已用尽, 增加额外随机数后重新挖矿
+		extraNonce++
+		block.updateExtraNonce(coinbaseData, extraNonce)
+		fmt.Printf("随机数空间已用尽, 额外随机数增加为: %d\n", extraNonce)
+	}
+}
+
+// 区块的第一笔交易是否为coinbase交易
+func (block *Block) hasCoinbase() bool {
+	return len(block.Transactions) > 0 && block.Transactions[0].IsCoinBase()
+}
+
+/*
+	summary：更新区块的额外随机数, 使区块头发生变化, 以便继续挖矿
+	coinbaseData: coinbase交易输入中原始的数据
+	extraNonce: 额外随机数
+*/
+func (block *Block) updateExtraNonce(coinbaseData []byte, extraNonce uint64) {
+	// 将额外随机数写入coinbase交易, coinbase交易ID变化后需重新计算默克尔根
+	if block.hasCoinbase() {
+		block.Transactions[0].SetExtraNonce(coinbaseData, extraNonce)
+		block.CreateMerkleTreeRoot(block.Transactions)
+	}
+
+	// 刷新区块头的时间戳, 并保证时间戳一定发生变化
+	now := int32(time.Now().Unix())
+	if now <= block.Time {
+		now = block.Time + 1
+	}
+	block.Time = now
+}
+
 // 创建当前区块的默克尔根
 func (block * Block) CreateMerkleTreeRoot(transactions []*transaction.Transaction) {
+	block.MerkleRoot = calcMerkleRoot(transactions)
+}
+
+// 验证区块头的默克尔根是否与区块中的交易一致
+func (block *Block) VerifyMerkleRoot() bool {
+	return bytes.Compare(calcMerkleRoot(block.Transactions), block.MerkleRoot) == 0
+}
+
+// 根据交易的Hash计算默克尔根, 没有交易时默克尔根为空
+func calcMerkleRoot(transactions []*transaction.Transaction) []byte {
+	if len(transactions) == 0 {
+		return []byte{}
+	}
+
 	var transHash [][]byte
 	for _, tx := range transactions {
 		transHash = append(transHash, tx.Hash())
 	}
 
 	mTree := algorithm.NewMerkleTree(transHash)
-	block.MerkleRoot = mTree.RootNode.Data
+	return mTree.RootNode.Data
 }
 
 // 打印当前区块内容
@@ -96,6 +196,9 @@ func (block *Block) String() {
 	fmt.Printf("当前区块的时间：%s\n", strconv.FormatInt(int64(block.Time), 10))
 	fmt.Printf("当前区块的难度：%s\n", strconv.FormatInt(int64(block.Bits), 10))
 	fmt.Printf("当前区块的Nonce：%s\n", strconv.FormatInt(int64(block.Nonce), 10))
+	if len(block.Signature) > 0 {
+		fmt.Printf("当前区块的权威节点签名：%x\n", block.Signature)
+	}
 	fmt.Println("----------------------------------------------------------------------------------")
 }
 
@@ -2,6 +2,9 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
+	"core/chaincfg"
+	"core/script"
 	"core/transaction"
 	"core/wallet"
 	"crypto/ecdsa"
@@ -10,33 +13,90 @@ import (
 	"fmt"
 	"github.com/boltdb"
 	"log"
+	"os"
+	"path/filepath"
+	"sync"
 )
 
-// 定义数据库文件名
+// 定义数据库文件名, 位于网络的数据目录下
 const dbFile = "blockchain.db"
 
 // 定义一个桶
 const blockBucket = "blocks"
 
-// 创世区块内容
-const genesisData = "这是创世区块的内容"
+// 挖矿期间区块链的最新区块已变化
+var ErrStaleTip = errors.New("区块链最新区块已变化，当前挖出的区块已过时")
 
 // 区块链结构体
 type Blockchain struct {
 	currentHash []byte  // 最近的一个区块的Hash值
 	db *bolt.DB
+
+	params *chaincfg.Params  // 区块链所属网络的参数
+	engine ConsensusEngine  // 共识引擎
+
+	tipLock sync.RWMutex  // 保护最近的一个区块的Hash值, 处理区块的同时其他协程可以读取
+	chainLock sync.Mutex  // 保证同一时间只处理一个区块(接收到的区块及本地挖出的区块)
+	orphanLock sync.Mutex  // 保护孤块池
+	orphans map[string]*orphanBlock  // 孤块池 key: 孤块Hash
+	prevOrphans map[string][]*orphanBlock  // key: 前一区块Hash, value: 以该区块为前一区块的孤块
+
+	timeSource *MedianTimeSource  // 网络调整时间, 用于验证区块的时间戳
+
+	headerLock sync.Mutex  // 保护已验证的区块头链
+	headerTip *BlockHeader  // 已验证的区块头链的最后一个区块头, 为nil表示尚未同步区块头
+	headerHashes map[string]bool  // 已验证的区块头链中的区块 key: 区块Hash的16进制字符串
+
+	versionBitsLock sync.Mutex  // 保护软分叉部署状态的缓存
+	versionBitsCache [chaincfg.DefinedDeployments]map[string]ThresholdState  // 每个部署的状态缓存 key: 表决周期最后一个区块Hash的16进制字符串
 }
 
 // 构建区块链的迭代器
 func (bc *Blockchain) iterator() *BlockchainIterator {
-	return &BlockchainIterator{bc.currentHash, bc.db}
+	return &BlockchainIterator{bc.GetCurrentHash(), bc.db}
 }
 
 // 获取当前区块链, 最近的一个区块的Hash值
 func (bc *Blockchain) GetCurrentHash() []byte {
+	bc.tipLock.RLock()
+	defer bc.tipLock.RUnlock()
+
 	return bc.currentHash
 }
 
+// 更新最近的一个区块的Hash值
+func (bc *Blockchain) setCurrentHash(hash []byte) {
+	bc.tipLock.Lock()
+	defer bc.tipLock.Unlock()
+
+	bc.currentHash = hash
+}
+
+// 获取区块链所属网络的参数
+func (bc *Blockchain) Params() *chaincfg.Params {
+	return bc.params
+}
+
+// 获取区块链使用的共识引擎
+func (bc *Blockchain) Engine() ConsensusEngine {
+	return bc.engine
+}
+
+// 替换区块链使用的共识引擎, 例如权威节点使用带签名私钥的权威证明共识引擎
+func (bc *Blockchain) SetEngine(engine ConsensusEngine) {
+	bc.engine = engine
+}
+
+// 获取区块链使用的网络调整时间
+func (bc *Blockchain) TimeSource() *MedianTimeSource {
+	return bc.timeSource
+}
+
+// 替换区块链使用的网络调整时间, 例如测试时使用可控制的时钟
+func (bc *Blockchain) SetTimeSource(timeSource *MedianTimeSource) {
+	bc.timeSource = timeSource
+}
+
 // 获取当前区块链的高度
 func (bc *Blockchain) GetBestHeight() int32 {
 	// 当前数据库最长区块的高度
@@ -47,7 +107,7 @@ func (bc *Blockchain) GetBestHeight() int32 {
 		// 打开当前桶
 		bucket := tx.Bucket([]byte(blockBucket))
 		// 通过区块的Hash得到区块的序列化
-		blockData := bucket.Get(bc.currentHash)
+		blockData := bucket.Get(bc.GetCurrentHash())
 		// 反序列化得到区块结构体
 		block := *DeserializeBlock(blockData)
 		// 获取当前区块高度
@@ -103,8 +163,21 @@ func (bc *Blockchain) GetBlockById(id []byte) (Block, error) {
 	return block, nil
 }
 
-// 往区块链中加入新区块
-func (bc *Blockchain) AddBlock(block *Block) {
+// 在数据库事务中根据区块的Hash获取区块
+func getBlock(tx *bolt.Tx, hash []byte) (*Block, error) {
+	blockData := tx.Bucket([]byte(blockBucket)).Get(hash)
+	if blockData == nil {
+		return nil, errors.New("未找到区块")
+	}
+
+	return DeserializeBlock(blockData), nil
+}
+
+// 往区块链中加入新区块, 区块必须通过全部共识规则的验证, 验证失败时返回RuleError且不写入数据库; 调用者需持有chainLock
+func (bc *Blockchain) addBlock(block *Block) error {
+	// 加入区块后的最新区块Hash
+	var newTip []byte
+
 	err := bc.db.Update(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket([]byte(blockBucket))
 
@@ -114,75 +187,156 @@ func (bc *Blockchain) AddBlock(block *Block) {
 			return nil
 		}
 
-		// 将区块数据进行序列化
-		blockData := block.Serialize()
+		// 验证区块本身及其与前一区块的关系
+		err := bc.checkBlock(tx, block)
+		if err != nil {
+			return err
+		}
 
-		// 加入数据库
-		err := bucket.Put(block.Hash, blockData)
+		// 将区块数据进行序列化, 并加入数据库
+		err = bucket.Put(block.Hash, block.Serialize())
 		if err != nil {
-			log.Panic(err)
+			return err
+		}
+
+		// 记录区块的累计工作量
+		blockWork, err := putChainWork(tx, block)
+		if err != nil {
+			return err
 		}
 
 		// 获取区块链中最后一个区块
 		lastHash := bucket.Get([]byte("l"))
-		lastBlockData := bucket.Get(lastHash)
-		lastBlock := DeserializeBlock(lastBlockData)
 
-		// 如果当前加入的区块的高度大于最后一个区块, 则更新最后一个区块
-		if block.Height > lastBlock.Height {
-			err = bucket.Put([]byte("l"), block.Hash)
+		// 当前区块连接在最后一个区块之后, 直接连接区块(同时验证区块中的交易)
+		if bytes.Compare(block.PrevBlockHash, lastHash) == 0 {
+			err = bc.connectBlock(tx, block)
 			if err != nil {
-				log.Panic(err)
+				return err
 			}
 
-			// 更新区块链当前最新区块的Hash
-			bc.currentHash = block.Hash
+			newTip = block.Hash
+			return nil
+		}
+
+		// 当前区块位于分叉链上, 累计工作量不大于最后一个区块时只保存区块
+		lastBlock := DeserializeBlock(bucket.Get(lastHash))
+		lastWork, err := getChainWork(tx, lastBlock)
+		if err != nil {
+			return err
+		}
+
+		if blockWork.Cmp(lastWork) <= 0 {
+			return nil
 		}
+
+		// 分叉链的累计工作量超过了当前主链, 切换到分叉链
+		err = bc.reorganizeChain(tx, lastBlock, block)
+		if err != nil {
+			return err
+		}
+
+		newTip = block.Hash
 		return nil
 	})
 
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+
+	// 数据库事务提交成功后, 更新区块链当前最新区块的Hash
+	if newTip != nil {
+		bc.setCurrentHash(newTip)
 	}
+
+	return nil
 }
 
-// 往区块链中加入区块(即挖矿)
-func (bc * Blockchain) MineBlock(transactions []*transaction.Transaction) *Block{
-	// 验证所有交易是否有效
-	for _, tx := range transactions {
-		if bc.VerifyTransaction(tx) == false {
-			log.Panic("Error: INVALID TRANSACTION!")
+/*
+	summary：在同一个数据库事务中将主链切换到累计工作量更大的分叉链, 任一区块连接失败时整个事务回滚, UTXO与最新区块保持不变
+	lastBlock: 当前主链的最新区块
+	newBlock: 分叉链的最新区块
+*/
+func (bc *Blockchain) reorganizeChain(tx *bolt.Tx, lastBlock *Block, newBlock *Block) error {
+	detachBlocks, attachBlocks, fork, err := findFork(tx, lastBlock, newBlock)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("区块链发生分叉切换, 分叉点: %x, 断开区块数: %d, 连接区块数: %d\n",
+		fork.Hash, len(detachBlocks), len(attachBlocks))
+
+	// 从最新区块开始断开主链区块, 回滚UTXO
+	for _, block := range detachBlocks {
+		err := disconnectBlock(tx, block)
+		if err != nil {
+			return err
 		}
 	}
 
-	// 获取当前数据库最长区块的高度
-	lastHeight := bc.GetBestHeight()
+	// 从分叉点开始依次连接分叉链区块, 连接时验证区块中的交易
+	for i := len(attachBlocks) - 1; i >= 0; i-- {
+		err := bc.connectBlock(tx, attachBlocks[i])
+		if err != nil {
+			return err
+		}
+	}
 
-	// 根据前一区块hash和高度构建当前区块, 新的区块的高度比上一区块增加1
-	newBlock := NewBlock(transactions, bc.currentHash, lastHeight + 1)
+	return nil
+}
 
-	// 更新当前区块链所在的数据库
-	err := bc.db.Update(func(tx *bolt.Tx) error {
-		// 打开当前桶
-		bucket := tx.Bucket([]byte(blockBucket))
+/*
+	summary：从两条链的最新区块往前回溯, 直到找到分叉点
+	mainBlock: 主链的最新区块
+	sideBlock: 分叉链的最新区块
+	return: 主链上分叉点之后的区块(从新到旧), 分叉链上分叉点之后的区块(从新到旧), 分叉点区块
+*/
+func findFork(tx *bolt.Tx, mainBlock *Block, sideBlock *Block) ([]*Block, []*Block, *Block, error) {
+	var detachBlocks []*Block
+	var attachBlocks []*Block
+
+	for bytes.Compare(mainBlock.Hash, sideBlock.Hash) != 0 {
+		var err error
+		if sideBlock.Height >= mainBlock.Height {
+			attachBlocks = append(attachBlocks, sideBlock)
+			sideBlock, err = getBlock(tx, sideBlock.PrevBlockHash)
+		} else {
+			detachBlocks = append(detachBlocks, mainBlock)
+			mainBlock, err = getBlock(tx, mainBlock.PrevBlockHash)
+		}
 
-		// 往桶里插入key:当前区块Hash, value: 当前区块的序列化值
-		err := bucket.Put(newBlock.Hash, newBlock.Serialize())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return detachBlocks, attachBlocks, mainBlock, nil
+}
+
+// 获取以oldTip为最新区块的链上已不在当前主链中的区块(从新到旧), 即切换分叉链时被断开的区块
+func (bc *Blockchain) DisconnectedBlocks(oldTip []byte) ([]*Block, error) {
+	var detachBlocks []*Block
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		oldBlock, err := getBlock(tx, oldTip)
 		if err != nil {
 			return err
 		}
 
-		// 将最新区块的Hash更新到key=l，数据库中l对应了最新的区块
-		err = bucket.Put([]byte("l"), newBlock.Hash)
+		tipBlock, err := getBlock(tx, bc.GetCurrentHash())
 		if err != nil {
 			return err
 		}
 
-		// 更新当前区块链的最近一个区块hash为当前区块hash
-		bc.currentHash = newBlock.Hash
-		return nil
+		detachBlocks, _, _, err = findFork(tx, oldBlock, tipBlock)
+		return err
 	})
 
+	return detachBlocks, err
+}
+
+// 往区块链中加入区块(即挖矿), coinbase交易的奖励支付给矿工地址
+func (bc * Blockchain) MineBlock(minerAddress string, transactions []*transaction.Transaction) *Block{
+	newBlock, err := bc.MineBlockWithContext(context.Background(), minerAddress, transactions)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -190,6 +344,96 @@ func (bc * Blockchain) MineBlock(transactions []*transaction.Transaction) *Block
 	return newBlock
 }
 
+// 往区块链中加入区块(即挖矿), 可通过上下文取消挖矿(例如收到了其他节点的新区块)
+func (bc *Blockchain) MineBlockWithContext(ctx context.Context, minerAddress string, transactions []*transaction.Transaction) (*Block, error) {
+	// 获取当前区块链的最后一个区块
+	lastBlock, err := bc.GetBlockById(bc.GetCurrentHash())
+	if err != nil {
+		return nil, err
+	}
+
+	// 根据前面区块的时间戳计算新区块的难度值
+	bits, err := bc.CalcNextRequiredBits(&lastBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	// 区块的第一笔交易为支付给矿工的coinbase交易, 交易数据以区块高度开头, 保证不同区块的coinbase交易ID不同
+	height := lastBlock.Height + 1
+	coinbaseData := string(coinbaseHeightPrefix(height)) + fmt.Sprintf("区块高度: %d", height)
+	coinbase := transaction.NewCoinBaseTx(minerAddress, coinbaseData, transaction.GetBlockSubsidy(bc.params, height))
+
+	// 只选择满足区块大小、交易数量及签名操作数量限制的交易
+	err = bc.db.View(func(tx *bolt.Tx) error {
+		transactions = selectBlockTransactions(tx.Bucket([]byte(utxoBucket)), height, coinbase, transactions)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 根据前一区块hash、高度和难度值构建当前区块, 新的区块的高度比上一区块增加1
+	newBlock := newBlockTemplate(transactions, lastBlock.Hash, height, bits)
+
+	// 区块的时间戳使用网络调整时间, 且必须大于前11个区块时间戳的中位数; 区块的版本号对正在表决的软分叉部署表决支持
+	var medianTime int64
+	err = bc.db.View(func(tx *bolt.Tx) error {
+		var err error
+		medianTime, err = calcPastMedianTime(tx, &lastBlock)
+		if err != nil {
+			return err
+		}
+
+		newBlock.Version, err = bc.calcNextBlockVersion(tx, &lastBlock)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	newBlock.Time = int32(bc.timeSource.AdjustedTime().Unix())
+	if int64(newBlock.Time) <= medianTime {
+		newBlock.Time = int32(medianTime + 1)
+	}
+
+	// 挖矿之前先验证所有交易是否有效, 并计算区块内交易的手续费之和
+	var fees int
+	err = bc.db.View(func(tx *bolt.Tx) error {
+		var err error
+		fees, err = bc.checkBlockTransactions(tx, newBlock, true)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// coinbase交易的金额为区块奖励与手续费之和, 金额变化后重新计算交易ID及默克尔根
+	if fees > 0 {
+		coinbase.Vout[0].Value += fees
+		coinbase.ID = coinbase.Hash()
+		newBlock.CreateMerkleTreeRoot(newBlock.Transactions)
+	}
+
+	// 通过共识引擎封装区块(工作量证明为挖矿, 权威证明为签名)
+	err = bc.engine.Seal(ctx, newBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	// 与接收到的区块一样通过ProcessBlock加入区块链, 保证同一时间只处理一个区块, 并连接等待该区块的孤块
+	_, err = bc.ProcessBlock(newBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	// 挖矿期间最新区块已变化, 当前区块只能作为分叉链上的区块
+	if bytes.Compare(bc.GetCurrentHash(), newBlock.Hash) != 0 {
+		return nil, ErrStaleTip
+	}
+
+	return newBlock, nil
+}
+
 // 循环打印区块链
 func (bc *Blockchain) PrintBlockchain() {
 	bci := bc.iterator()
@@ -219,8 +463,10 @@ func (bc *Blockchain) FindAllUTXO() map[string]transaction.TXOutputs {
 	for {
 		block := bci.Next()
 
-		// 循环遍历区块的交易
-		for _, tx := range block.Transactions {
+		// 倒序遍历区块的交易, 同一区块中后面的交易可能花费前面交易的输出
+		for i := len(block.Transactions) - 1; i >= 0; i-- {
+			tx := block.Transactions[i]
+
 			// 将交易的ID转为string
 			txID := hex.EncodeToString(tx.ID)
 
@@ -240,10 +486,15 @@ func (bc *Blockchain) FindAllUTXO() map[string]transaction.TXOutputs {
 					}
 				}
 
-				// 在已花费的UTXO中未找到当前输出, 表示当前输出尚未被花费, 存入UTXO
-				outs := UTXO[txID]
-				outs.Outputs = append(outs.Outputs, out)
-				UTXO[txID] = outs
+				// 在已花费的UTXO中未找到当前输出, 表示当前输出尚未被花费, 存入UTXO(保留输出在交易中的序号)
+				outs, ok := UTXO[txID]
+				if !ok {
+					outs = transaction.NewTXOutputs()
+					outs.Height = block.Height
+					outs.IsCoinbase = tx.IsCoinBase()
+					UTXO[txID] = outs
+				}
+				outs.Outputs[outId] = out
 			}
 
 			// 如果区块不是CoinBase, 则记录交易的输入到已花费UTXO中
@@ -252,7 +503,7 @@ func (bc *Blockchain) FindAllUTXO() map[string]transaction.TXOutputs {
 				for _, in := range tx.Vin {
 					inTxId := hex.EncodeToString(in.TXid)
 					// 记录交易的输入到已花费UTXO中  string：交易的ID --> []int：输入对应的输出
-					spendTXOs[inTxId] = append(spendTXOs[txID], in.VoutIndex)
+					spendTXOs[inTxId] = append(spendTXOs[inTxId], in.VoutIndex)
 				}
 			}
 		}
@@ -349,7 +600,7 @@ func (bc *Blockchain) FindUTXO(pubkeyHash []byte) []transaction.TXOutput {
 }
 
 /*
-	summary：根据转账地址和待转账金额获取能够转账的金额和相应的有效的输出
+	summary：根据转账地址和待转账金额获取能够转账的金额和相应的有效的输出, 未成熟的coinbase输出不能用于转账
 	address：查询地址
 	amount: 需要获取的金额
 	return: 获取的总金额； 未花费的输出与交易的映射
@@ -358,30 +609,49 @@ func (bc *Blockchain) FindSpendableOutputs(pubkeyHash []byte, amount int) (int,
 	// 存放未花费的输出的交易 string：交易的Hash --> []int：未花费的输出的序号
 	unspenTXOs := make(map[string][]int)
 
-	// 根据地址获取存在未花费输出的交易
-	unspentTXs := bc.FindUnspentTransactions(pubkeyHash)
-
 	// 获取的总金额
 	total := 0
 
-	// 循环遍历未花费的交易
-	Work:
-	for _, tx := range unspentTXs {
-		txID := hex.EncodeToString(tx.ID)
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		// 转账交易最早被打包进下一个区块, 按下一个区块的高度判断coinbase输出是否成熟
+		lastBlock, err := getBlock(tx, bc.GetCurrentHash())
+		if err != nil {
+			return err
+		}
+		height := lastBlock.Height + 1
 
-		// 循环遍历交易的输出
-		for outIdx, out := range tx.Vout {
-			// 输出属于当前地址则记录
-			if out.CanBeUnlockedWith(pubkeyHash) && total < amount {
-				total += out.Value
-				unspenTXOs[txID] = append(unspenTXOs[txID], outIdx)
-
-				// 总金额已大于或等于需要获得金额则退出循环
-				if total >= amount {
-					break Work
+		// 循环遍历UTXO桶  key: 交易ID, Value: 当前交易所有未花费的输出的序列化
+		cursor := tx.Bucket([]byte(utxoBucket)).Cursor()
+
+		Work:
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			outs := transaction.DeserializeOutputs(value)
+			if !outs.IsMature(height, bc.params.CoinbaseMaturity) {
+				continue
+			}
+
+			txID := hex.EncodeToString(key)
+
+			// 循环遍历交易未花费的输出
+			for outIdx, out := range outs.Outputs {
+				// 输出属于当前地址则记录
+				if out.CanBeUnlockedWith(pubkeyHash) {
+					total += out.Value
+					unspenTXOs[txID] = append(unspenTXOs[txID], outIdx)
+
+					// 总金额已大于或等于需要获得金额则退出循环
+					if total >= amount {
+						break Work
+					}
 				}
 			}
 		}
+
+		return nil
+	})
+
+	if err != nil {
+		log.Panic(err)
 	}
 
 	return total, unspenTXOs
@@ -449,12 +719,26 @@ func (bc *Blockchain) VerifyTransaction(tx *transaction.Transaction) bool {
 	return tx.Verify(prevTXs)
 }
 
-// 创建新的区块链
-func NewBlockchain(address string) *Blockchain {
+// 根据网络参数打开或创建区块链, 数据库文件位于网络的数据目录下
+func NewBlockchain(params *chaincfg.Params) *Blockchain {
+	// 根据网络参数构建共识引擎, 默认只验证区块
+	engine, err := NewEngine(params, nil)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	// 创建网络的数据目录
+	if params.DataDir != "" {
+		err = os.MkdirAll(params.DataDir, 0700)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
 	// 定义当前最近的一个区块的Hash值
 	var tip []byte
 	// 打开当前数据库文件
-	db, err := bolt.Open(dbFile, 0600, nil)
+	db, err := bolt.Open(filepath.Join(params.DataDir, dbFile), 0600, nil)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -465,11 +749,8 @@ func NewBlockchain(address string) *Blockchain {
 		if bucket == nil {
 			fmt.Println("数据库中不存在区块链，创建一个新的区块链")
 
-			// 创建交易
-			newTransaction := transaction.NewCoinBaseTx(address, genesisData)
-
-			// 创建一个创世区块
-			genesis := NewGensisBlock([]*transaction.Transaction{newTransaction})
+			// 创建网络的创世区块
+			genesis := NewGensisBlock(params)
 			// 创建一个桶
 			bucket, err = tx.CreateBucket([]byte(blockBucket))
 			if err != nil {
@@ -488,21 +769,52 @@ func NewBlockchain(address string) *Blockchain {
 				log.Panic(err)
 			}
 
+			// 记录创世区块的累计工作量
+			_, err = tx.CreateBucket([]byte(chainworkBucket))
+			if err != nil {
+				log.Panic(err)
+			}
+
+			_, err = putChainWork(tx, genesis)
+			if err != nil {
+				log.Panic(err)
+			}
+
 			// 最近区块就是创世区块
 			tip = genesis.Hash
 		} else {
-			// 获取当前数据库中最新的区块hash
-			tip = bucket.Get([]byte("l"))
+			// 获取当前数据库中最新的区块hash, Get返回的数据只在事务内有效, 需要复制
+			tip = append([]byte{}, bucket.Get([]byte("l"))...)
 		}
 
-		return nil
+		// 创建存放区块累计工作量的桶, 用于选择累计工作量最大的链
+		_, err = tx.CreateBucketIfNotExists([]byte(chainworkBucket))
+		if err != nil {
+			return err
+		}
+
+		// 创建存放区块撤销数据的桶, 用于分叉链切换时回滚UTXO
+		_, err = tx.CreateBucketIfNotExists([]byte(undoBucket))
+		return err
 	})
 
 	if err != nil {
 		log.Panic(err)
 	}
 
-	bc := Blockchain{tip, db}
+	bc := Blockchain{
+		currentHash: tip,
+		db:          db,
+		params:      params,
+		engine:      engine,
+		orphans:     make(map[string]*orphanBlock),
+		prevOrphans: make(map[string][]*orphanBlock),
+		timeSource:  NewMedianTimeSource(SystemClock),
+	}
+
+	for id := range bc.versionBitsCache {
+		bc.versionBitsCache[id] = make(map[string]ThresholdState)
+	}
 
 	// 将区块链的UTXO写入数据库
 	utxoSet := UTXOSet{&bc}
@@ -515,15 +827,20 @@ func NewBlockchain(address string) *Blockchain {
 	from: 转出地址
 	to: 转入地址
 	amount: 转账金额
+	fee: 交易手续费, 由打包交易的矿工获得
 	bc: 操作所属的区块链
 	return: &Transaction 新的交易对象地址
 */
-func NewUTXOTransaction(from, to string, amount int, bc *Blockchain) *transaction.Transaction {
+func NewUTXOTransaction(from, to string, amount, fee int, bc *Blockchain) *transaction.Transaction {
+	if fee < 0 {
+		log.Panic("交易手续费不能为负数，转账失败！")
+	}
+
 	var inputs []transaction.TXInput
 	var outputs []transaction.TXOutput
 
 	// 读取当前钱包数据
-	wallets, err := wallet.NewWallets()
+	wallets, err := wallet.NewWallets(bc.params)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -534,10 +851,10 @@ func NewUTXOTransaction(from, to string, amount int, bc *Blockchain) *transactio
 	// 将钱包公钥进行Hash得到Pubkey Hash
 	fromPubkeyHash := wallet.HashPubKey(newWalet.PublicKey)
 
-	// 根据转账地址和待转账金额获取能够转账的金额和相应的有效的输出
-	total, validaoutputs := bc.FindSpendableOutputs(fromPubkeyHash, amount)
-	if total < amount {
-		log.Panic("当前地址的金额小于待转账金额，转账失败！")
+	// 根据转账地址和待转账金额(包含手续费)获取能够转账的金额和相应的有效的输出
+	total, validaoutputs := bc.FindSpendableOutputs(fromPubkeyHash, amount + fee)
+	if total < amount + fee {
+		log.Panic("当前地址的金额小于待转账金额与手续费之和，转账失败！")
 	}
 
 	// 循环遍历有效的输出
@@ -551,7 +868,7 @@ func NewUTXOTransaction(from, to string, amount int, bc *Blockchain) *transactio
 		// 循环遍历交易的输出
 		for _, out := range outs {
 			// 将有效的输出作为转账的输入, 添加到转账的输入集合
-			input := transaction.TXInput{txID, out, nil, newWalet.PublicKey}
+			input := transaction.TXInput{txID, out, nil}
 			inputs = append(inputs, input)
 		}
 	}
@@ -559,17 +876,72 @@ func NewUTXOTransaction(from, to string, amount int, bc *Blockchain) *transactio
 	// 将待转入的金额和地址作为交易的输出
 	outputs = append(outputs, *transaction.NewTXOutput(amount, to))
 
-	// 如果当前地址的可用金额大于待转账金额（零钱）, 则将多余的金额转回自己的地址, 并记录到当前交易的输出
-	if total > amount {
-		outputs = append(outputs, *transaction.NewTXOutput(total - amount, from))
+	// 如果当前地址的可用金额大于待转账金额与手续费之和（零钱）, 则将多余的金额转回自己的地址, 并记录到当前交易的输出
+	// 输入与输出的差额即为手续费
+	if total > amount + fee {
+		outputs = append(outputs, *transaction.NewTXOutput(total - amount - fee, from))
 	}
 
 	// 构建交易对象
 	tx := transaction.Transaction{nil, inputs, outputs}
-	// 当前交易的Hash作为交易的ID
-	tx.ID = tx.Hash()
 
 	// 根据私钥对交易进行数据签名
 	bc.SignTransaction(&tx, newWalet.PrivateKey)
+
+	// 签名后当前交易的Hash作为交易的ID, 交易ID包含签名, 区块验证时会检查交易ID与交易内容是否一致
+	tx.ID = tx.Hash()
+	return &tx
+}
+
+/*
+	summary：构建花费多重签名地址输出的交易, 交易的输入只包含赎回脚本, 需要由多个钱包通过SignMultiSig签名后才有效
+	redeemScript: 多重签名的赎回脚本, 转出地址为赎回脚本的脚本Hash地址
+	to: 转入地址
+	amount: 转账金额
+	fee: 交易手续费, 由打包交易的矿工获得
+	bc: 操作所属的区块链
+	return: &Transaction 未签名的交易对象地址
+*/
+func NewMultiSigTransaction(redeemScript []byte, to string, amount, fee int, bc *Blockchain) *transaction.Transaction {
+	if fee < 0 {
+		log.Panic("交易手续费不能为负数，转账失败！")
+	}
+
+	var inputs []transaction.TXInput
+	var outputs []transaction.TXOutput
+
+	// 转出地址为赎回脚本的脚本Hash地址
+	scriptHash := script.Hash160(redeemScript)
+	from := string(wallet.ScriptHashAddress(bc.params, scriptHash))
+
+	// 根据脚本Hash和待转账金额(包含手续费)获取能够转账的金额和相应的有效的输出
+	total, validaoutputs := bc.FindSpendableOutputs(scriptHash, amount + fee)
+	if total < amount + fee {
+		log.Panic("当前多重签名地址的金额小于待转账金额与手续费之和，转账失败！")
+	}
+
+	for txId, outs := range validaoutputs {
+		txID, err := hex.DecodeString(txId)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		for _, out := range outs {
+			input, err := transaction.NewMultiSigTXInput(txID, out, redeemScript)
+			if err != nil {
+				log.Panic(err)
+			}
+			inputs = append(inputs, input)
+		}
+	}
+
+	// 将待转入的金额和地址作为交易的输出, 零钱转回多重签名地址
+	outputs = append(outputs, *transaction.NewTXOutput(amount, to))
+	if total > amount + fee {
+		outputs = append(outputs, *transaction.NewTXOutput(total - amount - fee, from))
+	}
+
+	tx := transaction.Transaction{nil, inputs, outputs}
+	tx.ID = tx.Hash()
 	return &tx
 }
\ No newline at end of file
@@ -0,0 +1,83 @@
+package blockchain
+
+import (
+	"github.com/boltdb"
+	"log"
+	"math/big"
+)
+
+// 存放区块累计工作量的桶 key: 区块Hash, value: 从创世区块到该区块的累计工作量
+const chainworkBucket = "chainwork"
+
+/*
+	summary：在数据库事务中获取区块的累计工作量
+	未记录累计工作量的区块(例如升级前的数据库)会沿前一区块往前回溯计算
+*/
+func getChainWork(tx *bolt.Tx, block *Block) (*big.Int, error) {
+	bucket := tx.Bucket([]byte(chainworkBucket))
+
+	// 往前回溯到已记录累计工作量的区块或创世区块, 沿途累加区块的工作量
+	work := big.NewInt(0)
+	for {
+		if data := bucket.Get(block.Hash); data != nil {
+			return work.Add(work, new(big.Int).SetBytes(data)), nil
+		}
+
+		work.Add(work, CalcWork(block.Bits))
+		if len(block.PrevBlockHash) == 0 {
+			return work, nil
+		}
+
+		var err error
+		block, err = getBlock(tx, block.PrevBlockHash)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// 在数据库事务中记录区块的累计工作量: 前一区块的累计工作量 + 当前区块的工作量
+func putChainWork(tx *bolt.Tx, block *Block) (*big.Int, error) {
+	work := CalcWork(block.Bits)
+	if len(block.PrevBlockHash) > 0 {
+		prevBlock, err := getBlock(tx, block.PrevBlockHash)
+		if err != nil {
+			return nil, err
+		}
+
+		prevWork, err := getChainWork(tx, prevBlock)
+		if err != nil {
+			return nil, err
+		}
+
+		work.Add(work, prevWork)
+	}
+
+	err := tx.Bucket([]byte(chainworkBucket)).Put(block.Hash, work.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return work, nil
+}
+
+// 获取当前区块链最新区块的累计工作量
+func (bc *Blockchain) GetBestWork() *big.Int {
+	var work *big.Int
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		block, err := getBlock(tx, bc.GetCurrentHash())
+		if err != nil {
+			return err
+		}
+
+		work, err = getChainWork(tx, block)
+		return err
+	})
+
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return work
+}
@@ -0,0 +1,96 @@
+/*
+  检查点与假定有效区块：检查点之前的分叉直接拒绝，假定有效区块的祖先区块跳过签名验证以加快同步
+*/
+package blockchain
+
+import (
+	"bytes"
+	"core/chaincfg"
+	"encoding/hex"
+	"fmt"
+	"github.com/boltdb"
+)
+
+// 获取网络中指定高度的检查点
+func findCheckpoint(params *chaincfg.Params, height int32) (chaincfg.Checkpoint, bool) {
+	for _, checkpoint := range params.Checkpoints {
+		if checkpoint.Height == height {
+			return checkpoint, true
+		}
+	}
+
+	return chaincfg.Checkpoint{}, false
+}
+
+// 获取网络中不高于指定高度的最新检查点, 即区块链已经经过的最新检查点
+func latestCheckpoint(params *chaincfg.Params, height int32) (chaincfg.Checkpoint, bool) {
+	checkpoints := params.Checkpoints
+	for i := len(checkpoints) - 1; i >= 0; i-- {
+		if checkpoints[i].Height <= height {
+			return checkpoints[i], true
+		}
+	}
+
+	return chaincfg.Checkpoint{}, false
+}
+
+/*
+	summary：根据检查点验证区块: 检查点高度的区块Hash必须与检查点一致, 且不能在已经经过的最新检查点之前分叉
+	tx: 数据库事务, 用于获取当前最新区块的高度
+*/
+func (bc *Blockchain) checkBlockCheckpoints(tx *bolt.Tx, block *Block) error {
+	if checkpoint, ok := findCheckpoint(bc.params, block.Height); ok {
+		if hex.EncodeToString(block.Hash) != checkpoint.Hash {
+			return ruleError(ErrBadCheckpoint, fmt.Sprintf("区块 %x 与高度 %d 的检查点 %s 不一致", block.Hash, block.Height, checkpoint.Hash))
+		}
+	}
+
+	lastBlock, err := getBlock(tx, tx.Bucket([]byte(blockBucket)).Get([]byte("l")))
+	if err != nil {
+		return err
+	}
+
+	// 主链已经经过检查点, 不高于检查点的区块一定是在检查点之前分叉的区块
+	checkpoint, ok := latestCheckpoint(bc.params, lastBlock.Height)
+	if ok && block.Height <= checkpoint.Height {
+		return ruleError(ErrForkTooOld, fmt.Sprintf("区块 %x 的高度 %d 不高于已经经过的检查点高度 %d", block.Hash, block.Height, checkpoint.Height))
+	}
+
+	return nil
+}
+
+/*
+	summary：判断区块是否为假定有效区块或其祖先区块, 是则连接区块时不验证交易签名
+	假定有效区块已保存时, 从该区块沿前一区块Hash往前回溯到区块所在高度判断是否为其祖先区块;
+	否则判断区块是否在已验证工作量证明且到达假定有效区块的区块头链上(区块Hash已在区块验证时与区块头核对),
+	不信任其他节点提供的区块清单; 两者都没有时所有区块都验证签名
+	tx: 数据库事务, 用于读取假定有效区块及其祖先区块
+*/
+func (bc *Blockchain) isAssumedValid(tx *bolt.Tx, block *Block) (bool, error) {
+	if bc.params.AssumeValid == "" {
+		return false, nil
+	}
+
+	assumeHash, err := hex.DecodeString(bc.params.AssumeValid)
+	if err != nil {
+		return false, err
+	}
+
+	if tx.Bucket([]byte(blockBucket)).Get(assumeHash) == nil {
+		return bc.onAssumedValidHeaders(block.Hash), nil
+	}
+
+	ancestor, err := getBlock(tx, assumeHash)
+	if err != nil {
+		return false, err
+	}
+
+	for ancestor.Height > block.Height {
+		ancestor, err = getBlock(tx, ancestor.PrevBlockHash)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return bytes.Equal(ancestor.Hash, block.Hash), nil
+}
@@ -0,0 +1,82 @@
+/*
+  难度调整算法，根据区块的时间戳计算下一个区块的难度值
+*/
+package blockchain
+
+import (
+	"core/chaincfg"
+	"github.com/boltdb"
+	"math/big"
+	"utils"
+)
+
+/*
+	summary：根据前一区块及之前区块的时间戳，计算下一个区块需要的难度值
+	prevBlock: 下一个区块的前一区块
+	return: 下一个区块的难度值Bits
+*/
+func (bc *Blockchain) CalcNextRequiredBits(prevBlock *Block) (int32, error) {
+	var bits int32
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		var err error
+		bits, err = bc.engine.CalcDifficulty(tx, prevBlock)
+		return err
+	})
+
+	return bits, err
+}
+
+// 在数据库事务中根据网络的难度调整参数计算下一个区块需要的难度值
+func calcNextRequiredBits(tx *bolt.Tx, params *chaincfg.Params, prevBlock *Block) (int32, error) {
+	// 未设置调整周期, 或者未到难度调整的高度, 沿用前一区块的难度
+	if params.RetargetInterval <= 0 || (prevBlock.Height + 1) % params.RetargetInterval != 0 {
+		return prevBlock.Bits, nil
+	}
+
+	// 往前找到当前难度调整周期的第一个区块
+	firstBlock := prevBlock
+	for i := int32(0); i < params.RetargetInterval - 1; i++ {
+		block, err := getBlock(tx, firstBlock.PrevBlockHash)
+		if err != nil {
+			return 0, err
+		}
+
+		firstBlock = block
+	}
+
+	// 当前周期实际花费的时间与期望花费的时间
+	actualTimespan := int64(prevBlock.Time) - int64(firstBlock.Time)
+	targetTimespan := int64(params.RetargetInterval - 1) * int64(params.TargetBlockTime)
+
+	// 限制单次调整的幅度, 避免难度剧烈波动
+	minTimespan := targetTimespan / params.MaxAdjustFactor
+	maxTimespan := targetTimespan * params.MaxAdjustFactor
+	if actualTimespan < minTimespan {
+		actualTimespan = minTimespan
+	} else if actualTimespan > maxTimespan {
+		actualTimespan = maxTimespan
+	}
+
+	// 新目标值 = 旧目标值 * 实际花费时间 / 期望花费时间
+	oldTarget, _, _ := utils.CompactToBig(uint32(prevBlock.Bits))
+	newTarget := new(big.Int).Mul(oldTarget, big.NewInt(actualTimespan))
+	newTarget.Div(newTarget, big.NewInt(targetTimespan))
+
+	// 难度不能低于最低难度
+	if newTarget.Cmp(params.PowLimit()) > 0 {
+		newTarget = params.PowLimit()
+	}
+
+	return int32(utils.BigToCompact(newTarget)), nil
+}
+
+// 根据难度值计算区块的工作量, 工作量 = 2^256 / (目标值 + 1), 即找到满足难度的hash值期望的计算次数
+func CalcWork(bits int32) *big.Int {
+	target, negative, overflow := utils.CompactToBig(uint32(bits))
+	if negative || overflow || target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+
+	denominator := new(big.Int).Add(target, big.NewInt(1))
+	return new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 256), denominator)
+}
@@ -0,0 +1,95 @@
+/*
+  共识引擎，区块的封装（挖矿或签名）、区块头验证以及难度计算均通过共识引擎完成
+*/
+package blockchain
+
+import (
+	"context"
+	"core/chaincfg"
+	"crypto/ecdsa"
+	"fmt"
+	"github.com/boltdb"
+)
+
+// 共识引擎
+type ConsensusEngine interface {
+	// 计算当前节点构建的下一个区块的难度值, prevBlock为下一个区块的前一区块
+	CalcDifficulty(tx *bolt.Tx, prevBlock *Block) (int32, error)
+
+	// 封装区块: 设置区块的Hash及共识相关的字段, 可通过上下文取消
+	Seal(ctx context.Context, block *Block) error
+
+	// 验证区块头中与共识相关的字段, 不依赖区块链中的其他区块, 验证失败时返回RuleError
+	VerifyHeader(block *Block) error
+
+	// 验证区块中依赖前面区块的共识字段(工作量证明为难度值, 权威证明为签名节点), 验证失败时返回RuleError
+	VerifyContext(tx *bolt.Tx, prevBlock *Block, block *Block) error
+}
+
+/*
+	summary：根据网络参数中的共识引擎类型构建共识引擎
+	signer: 权威证明共识下当前节点用于签名的私钥, 为nil表示只验证区块; 工作量证明共识下忽略
+*/
+func NewEngine(params *chaincfg.Params, signer *ecdsa.PrivateKey) (ConsensusEngine, error) {
+	switch params.Consensus {
+	case chaincfg.ConsensusPoW, "":
+		engine, err := NewPoWEngine(params)
+		if err != nil {
+			return nil, err
+		}
+		return engine, nil
+	case chaincfg.ConsensusPoA:
+		engine, err := NewPoAEngine(params, params.PoAAuthorities, signer)
+		if err != nil {
+			return nil, err
+		}
+		return engine, nil
+	default:
+		return nil, fmt.Errorf("未知的共识引擎类型: %s", params.Consensus)
+	}
+}
+
+// 工作量证明共识引擎
+type PoWEngine struct {
+	params *chaincfg.Params  // 网络参数, 包含最低难度及难度调整参数
+	powHash PowHashFunc  // 网络使用的工作量证明哈希函数
+}
+
+// 根据网络参数构建工作量证明共识引擎, 工作量证明算法参数无效时返回错误
+func NewPoWEngine(params *chaincfg.Params) (*PoWEngine, error) {
+	powHash, err := NewPowHashFunc(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PoWEngine{params, powHash}, nil
+}
+
+// 根据前面区块的时间戳调整难度
+func (engine *PoWEngine) CalcDifficulty(tx *bolt.Tx, prevBlock *Block) (int32, error) {
+	return calcNextRequiredBits(tx, engine.params, prevBlock)
+}
+
+// 挖矿, 找到满足难度的随机数
+func (engine *PoWEngine) Seal(ctx context.Context, block *Block) error {
+	return block.Mine(ctx, engine.powHash)
+}
+
+// 验证区块的工作量证明
+func (engine *PoWEngine) VerifyHeader(block *Block) error {
+	return checkProofOfWork(block, engine.params, engine.powHash)
+}
+
+// 区块的难度值必须等于难度调整算法计算的难度值
+func (engine *PoWEngine) VerifyContext(tx *bolt.Tx, prevBlock *Block, block *Block) error {
+	requiredBits, err := calcNextRequiredBits(tx, engine.params, prevBlock)
+	if err != nil {
+		return err
+	}
+
+	if block.Bits != requiredBits {
+		return ruleError(ErrBadBits, fmt.Sprintf("区块 %x 的难度值 %08x 与要求的难度值 %08x 不一致", block.Hash, block.Bits, requiredBits))
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package blockchain
+
+import "fmt"
+
+// 区块验证失败的错误码
+type ErrorCode int
+
+const (
+	// 区块中没有交易
+	ErrNoTransactions ErrorCode = iota
+
+	// 区块的交易数量超过限制
+	ErrTooManyTransactions
+
+	// 区块按固定格式计算的大小超过限制
+	ErrBlockTooBig
+
+	// 区块的签名操作数量超过限制
+	ErrTooManySigOps
+
+	// 区块的第一笔交易不是coinbase交易
+	ErrFirstTxNotCoinbase
+
+	// 区块中存在多笔coinbase交易
+	ErrMultipleCoinbases
+
+	// 区块中存在重复的交易
+	ErrDuplicateTx
+
+	// 交易的ID与交易内容的Hash不一致
+	ErrBadTxID
+
+	// 交易输出的金额为负数, 或输出金额及输出总金额超过金额上限
+	ErrBadTxOutValue
+
+	// 区块头的默克尔根与区块中的交易不一致
+	ErrBadMerkleRoot
+
+	// 区块的难度值超出范围
+	ErrUnexpectedDifficulty
+
+	// 区块的Hash不满足其声明的难度, 或与区块头不一致
+	ErrHighHash
+
+	// 区块不是由轮到的权威节点签名的
+	ErrBadBlockSignature
+
+	// 区块的难度值与难度调整算法计算的不一致
+	ErrBadBits
+
+	// 未找到区块的前一区块
+	ErrMissingParent
+
+	// 区块的高度不等于前一区块的高度加1
+	ErrBadHeight
+
+	// 区块的时间戳不大于前11个区块时间戳的中位数
+	ErrTimeTooOld
+
+	// 区块的时间戳超前网络调整时间太多
+	ErrTimeTooNew
+
+	// 区块与检查点不一致
+	ErrBadCheckpoint
+
+	// 区块在已经经过的检查点之前分叉
+	ErrForkTooOld
+
+	// 软分叉激活后, coinbase交易的数据未以区块高度开头
+	ErrBadCoinbaseHeight
+
+	// 交易的输入引用了不存在或已花费的输出
+	ErrMissingTxOut
+
+	// 交易的输入在区块中被重复花费
+	ErrDoubleSpend
+
+	// 交易的输入花费了未成熟的coinbase输出
+	ErrImmatureSpend
+
+	// 交易输入的签名无效
+	ErrBadSignature
+
+	// 交易输出的总金额大于输入的总金额
+	ErrSpendTooHigh
+
+	// coinbase交易的金额大于区块奖励与交易手续费之和
+	ErrBadCoinbaseValue
+
+	// 交易输入的总金额超过金额上限
+	ErrBadTxInValue
+
+	// 区块中交易手续费之和超过金额上限
+	ErrBadFees
+
+	// 权威证明共识下签名的权威节点在最近的区块中已签名过
+	ErrRecentSigner
+)
+
+// 错误码对应的名称
+var errorCodeStrings = map[ErrorCode]string{
+	ErrNoTransactions:       "ErrNoTransactions",
+	ErrTooManyTransactions:  "ErrTooManyTransactions",
+	ErrBlockTooBig:          "ErrBlockTooBig",
+	ErrTooManySigOps:        "ErrTooManySigOps",
+	ErrFirstTxNotCoinbase:   "ErrFirstTxNotCoinbase",
+	ErrMultipleCoinbases:    "ErrMultipleCoinbases",
+	ErrDuplicateTx:          "ErrDuplicateTx",
+	ErrBadTxID:              "ErrBadTxID",
+	ErrBadTxOutValue:        "ErrBadTxOutValue",
+	ErrBadMerkleRoot:        "ErrBadMerkleRoot",
+	ErrUnexpectedDifficulty: "ErrUnexpectedDifficulty",
+	ErrHighHash:             "ErrHighHash",
+	ErrBadBlockSignature:    "ErrBadBlockSignature",
+	ErrBadBits:              "ErrBadBits",
+	ErrMissingParent:        "ErrMissingParent",
+	ErrBadHeight:            "ErrBadHeight",
+	ErrTimeTooOld:           "ErrTimeTooOld",
+	ErrTimeTooNew:           "ErrTimeTooNew",
+	ErrBadCheckpoint:        "ErrBadCheckpoint",
+	ErrForkTooOld:           "ErrForkTooOld",
+	ErrBadCoinbaseHeight:    "ErrBadCoinbaseHeight",
+	ErrMissingTxOut:         "ErrMissingTxOut",
+	ErrDoubleSpend:          "ErrDoubleSpend",
+	ErrImmatureSpend:        "ErrImmatureSpend",
+	ErrBadSignature:         "ErrBadSignature",
+	ErrSpendTooHigh:         "ErrSpendTooHigh",
+	ErrBadCoinbaseValue:     "ErrBadCoinbaseValue",
+	ErrBadTxInValue:         "ErrBadTxInValue",
+	ErrBadFees:              "ErrBadFees",
+	ErrRecentSigner:         "ErrRecentSigner",
+}
+
+// 打印错误码
+func (e ErrorCode) String() string {
+	if s := errorCodeStrings[e]; s != "" {
+		return s
+	}
+
+	return fmt.Sprintf("Unknown ErrorCode (%d)", int(e))
+}
+
+// 违反共识规则的错误, 通过错误码区分具体违反的规则
+type RuleError struct {
+	ErrorCode   ErrorCode // 错误码
+	Description string    // 错误描述
+}
+
+// 实现error接口
+func (e RuleError) Error() string {
+	return e.Description
+}
+
+// 构建违反共识规则的错误
+func ruleError(code ErrorCode, desc string) RuleError {
+	return RuleError{ErrorCode: code, Description: desc}
+}
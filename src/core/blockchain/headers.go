@@ -0,0 +1,220 @@
+/*
+  区块头同步：获取区块之前先从其他节点获取区块头，验证区块头的工作量证明及连续性，
+  到达假定有效区块的区块头链上的区块连接时跳过签名验证
+*/
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+// 每次最多发送的区块头数量
+const MaxHeadersPerMsg = 2000
+
+// 已验证的区块头链最多保存的区块头数量, 超过时拒绝继续同步
+const maxHeaderChainLength = 200000
+
+// 区块头, 即区块中除交易以外的字段
+type BlockHeader struct {
+	Version int32
+	PrevBlockHash []byte
+	MerkleRoot []byte
+	Hash []byte
+	Time int32
+	Bits int32
+	Nonce int32
+	Height int32
+	Signature []byte  // 权威证明共识下权威节点对区块Hash的签名
+}
+
+// 获取区块的区块头
+func (block *Block) Header() *BlockHeader {
+	return &BlockHeader{
+		Version:       block.Version,
+		PrevBlockHash: block.PrevBlockHash,
+		MerkleRoot:    block.MerkleRoot,
+		Hash:          block.Hash,
+		Time:          block.Time,
+		Bits:          block.Bits,
+		Nonce:         block.Nonce,
+		Height:        block.Height,
+		Signature:     block.Signature,
+	}
+}
+
+// 构建只有区块头没有交易的区块, 用于通过共识引擎验证区块头
+func (header *BlockHeader) block() *Block {
+	return &Block{
+		Version:       header.Version,
+		PrevBlockHash: header.PrevBlockHash,
+		MerkleRoot:    header.MerkleRoot,
+		Hash:          header.Hash,
+		Time:          header.Time,
+		Bits:          header.Bits,
+		Nonce:         header.Nonce,
+		Height:        header.Height,
+		Signature:     header.Signature,
+	}
+}
+
+/*
+	summary：获取主链上指定区块之后的区块头, 从前往后排列, 最多MaxHeadersPerMsg个
+	startHash: 请求节点已有的最后一个区块(头)的Hash, 不在主链上时从创世区块之后开始
+*/
+func (bc *Blockchain) GetHeaders(startHash []byte) []*BlockHeader {
+	var headers []*BlockHeader
+
+	bci := bc.iterator()
+	for {
+		block := bci.Next()
+
+		// 到达起始区块或创世区块, 请求节点一定已有该区块
+		if bytes.Equal(block.Hash, startHash) || len(block.PrevBlockHash) == 0 {
+			break
+		}
+
+		headers = append(headers, block.Header())
+	}
+
+	// 迭代器从最新区块往前遍历, 倒序后从前往后排列
+	for i, j := 0, len(headers) - 1; i < j; i, j = i + 1, j - 1 {
+		headers[i], headers[j] = headers[j], headers[i]
+	}
+
+	if len(headers) > MaxHeadersPerMsg {
+		headers = headers[:MaxHeadersPerMsg]
+	}
+
+	return headers
+}
+
+// 是否需要先同步区块头: 设置了假定有效区块, 且该区块及其区块头均尚未得到
+func (bc *Blockchain) NeedHeaders() bool {
+	if bc.params.AssumeValid == "" {
+		return false
+	}
+
+	assumeHash, err := hex.DecodeString(bc.params.AssumeValid)
+	if err != nil {
+		return false
+	}
+
+	if _, err := bc.GetBlockById(assumeHash); err == nil {
+		return false
+	}
+
+	bc.headerLock.Lock()
+	defer bc.headerLock.Unlock()
+
+	return !bc.reachedAssumeValid()
+}
+
+// 请求区块头的起始Hash: 已验证的区块头链的最后一个区块头, 尚未同步区块头时为当前最新区块
+func (bc *Blockchain) HeaderLocator() []byte {
+	bc.headerLock.Lock()
+	defer bc.headerLock.Unlock()
+
+	if bc.headerTip != nil {
+		return bc.headerTip.Hash
+	}
+
+	return bc.GetCurrentHash()
+}
+
+/*
+	summary：验证并保存其他节点发送的区块头: 区块头必须从已保存的区块或已验证的区块头链的最后一个区块头开始,
+	高度及前一区块Hash连续, 满足工作量证明(或权威节点签名)及检查点; 到达假定有效区块后不再接收区块头
+	headers: 从前往后排列的区块头
+	return: 区块头验证失败时返回RuleError, 已验证的区块头链保持不变
+*/
+func (bc *Blockchain) ProcessHeaders(headers []*BlockHeader) error {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	bc.headerLock.Lock()
+	defer bc.headerLock.Unlock()
+
+	if bc.reachedAssumeValid() {
+		return nil
+	}
+
+	// 区块头链的起点: 已验证的区块头链的最后一个区块头, 或已保存的区块(重新开始同步区块头)
+	var prevHash []byte
+	var prevHeight int32
+	extend := bc.headerTip != nil && bytes.Equal(headers[0].PrevBlockHash, bc.headerTip.Hash)
+	if extend {
+		prevHash, prevHeight = bc.headerTip.Hash, bc.headerTip.Height
+	} else {
+		prevBlock, err := bc.GetBlockById(headers[0].PrevBlockHash)
+		if err != nil {
+			return ruleError(ErrMissingParent, fmt.Sprintf("未找到区块头 %x 的前一区块 %x", headers[0].Hash, headers[0].PrevBlockHash))
+		}
+		prevHash, prevHeight = prevBlock.Hash, prevBlock.Height
+	}
+
+	var accepted []*BlockHeader
+	for _, header := range headers {
+		if !bytes.Equal(header.PrevBlockHash, prevHash) {
+			return ruleError(ErrMissingParent, fmt.Sprintf("区块头 %x 的前一区块 %x 与上一个区块头 %x 不连续", header.Hash, header.PrevBlockHash, prevHash))
+		}
+
+		if header.Height != prevHeight + 1 {
+			return ruleError(ErrBadHeight, fmt.Sprintf("区块头 %x 的高度 %d 与前一区块的高度 %d 不连续", header.Hash, header.Height, prevHeight))
+		}
+
+		// 验证区块头的工作量证明(或权威节点的签名), 区块Hash必须与区块头一致
+		err := bc.engine.VerifyHeader(header.block())
+		if err != nil {
+			return err
+		}
+
+		if checkpoint, ok := findCheckpoint(bc.params, header.Height); ok && hex.EncodeToString(header.Hash) != checkpoint.Hash {
+			return ruleError(ErrBadCheckpoint, fmt.Sprintf("区块头 %x 与高度 %d 的检查点 %s 不一致", header.Hash, header.Height, checkpoint.Hash))
+		}
+
+		accepted = append(accepted, header)
+		prevHash, prevHeight = header.Hash, header.Height
+
+		// 到达假定有效区块, 之后的区块头不再需要
+		if hex.EncodeToString(header.Hash) == bc.params.AssumeValid {
+			break
+		}
+	}
+
+	chainLength := len(accepted)
+	if extend {
+		chainLength += len(bc.headerHashes)
+	}
+
+	if chainLength > maxHeaderChainLength {
+		return fmt.Errorf("区块头链超过最大长度 %d, 已停止同步区块头", maxHeaderChainLength)
+	}
+
+	// 从已保存的区块开始时丢弃原来的区块头链
+	if !extend {
+		bc.headerHashes = make(map[string]bool)
+	}
+
+	for _, header := range accepted {
+		bc.headerHashes[hex.EncodeToString(header.Hash)] = true
+	}
+	bc.headerTip = accepted[len(accepted) - 1]
+
+	return nil
+}
+
+// 已验证的区块头链是否已到达假定有效区块, 调用者需持有headerLock
+func (bc *Blockchain) reachedAssumeValid() bool {
+	return bc.headerTip != nil && hex.EncodeToString(bc.headerTip.Hash) == bc.params.AssumeValid
+}
+
+// 区块是否在到达假定有效区块的已验证区块头链上
+func (bc *Blockchain) onAssumedValidHeaders(hash []byte) bool {
+	bc.headerLock.Lock()
+	defer bc.headerLock.Unlock()
+
+	return bc.reachedAssumeValid() && bc.headerHashes[hex.EncodeToString(hash)]
+}
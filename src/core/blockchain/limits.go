@@ -0,0 +1,107 @@
+/*
+  区块大小限制：限制区块按固定格式计算的大小、交易数量及签名操作数量，并在组装区块时选择满足限制的交易
+*/
+package blockchain
+
+import (
+	"core/transaction"
+	"encoding/hex"
+	"github.com/boltdb"
+)
+
+// 区块按固定格式计算的最大字节数, 见Block.Size
+const MaxBlockSize = 1000000
+
+// 区块中最多包含的交易数量
+const MaxBlockTransactions = 10000
+
+// 区块中最多包含的签名操作数量, 包括花费支付到脚本Hash的输出时赎回脚本中的签名操作
+const MaxBlockSigOps = 20000
+
+// 区块头按固定格式计算的最大字节数: 版本号、时间戳、难度值、随机数、高度及交易数量各8个字节,
+// 前一区块Hash、默克尔根、区块Hash为8个字节的长度加32个字节, 权威证明的签名为8个字节的长度加64个字节
+const maxBlockHeaderSize = 6 * 8 + 3 * (8 + 32) + 8 + 64
+
+/*
+	summary：按固定格式计算区块的大小: 区块头的整数字段及交易数量各8个字节, 字节字段为8个字节的长度加内容,
+	再加上每笔交易固定格式序列化(Seialize)的大小; 区块大小限制、组装区块及交易池都按该格式计算, 与区块的gob编码无关
+*/
+func (block *Block) Size() int {
+	size := 6 * 8
+	for _, field := range [][]byte{block.PrevBlockHash, block.MerkleRoot, block.Hash, block.Signature} {
+		size += 8 + len(field)
+	}
+
+	for _, tx := range block.Transactions {
+		size += len(tx.Seialize())
+	}
+
+	return size
+}
+
+// 计算区块中全部交易的签名操作数量
+func countBlockSigOps(block *Block) int {
+	sigOps := 0
+	for _, tx := range block.Transactions {
+		sigOps += tx.SigOpCount()
+	}
+
+	return sigOps
+}
+
+/*
+	summary：按顺序选择满足区块大小、交易数量及签名操作数量限制的交易, 放不下的交易及依赖它的交易不会被选择
+	utxo: UTXO桶, 用于查找交易花费的输出, 以计算花费支付到脚本Hash的输出时赎回脚本中的签名操作数量
+	height: 区块的高度
+	coinbase: 区块的coinbase交易
+	transactions: 候选交易
+	return: 包含coinbase交易在内的区块交易
+*/
+func selectBlockTransactions(utxo *bolt.Bucket, height int32, coinbase *transaction.Transaction, transactions []*transaction.Transaction) []*transaction.Transaction {
+	selected := []*transaction.Transaction{coinbase}
+
+	// 已选择的交易, 后面的交易可以花费其输出 key: 交易ID
+	selectedTXs := map[string]*transaction.Transaction{hex.EncodeToString(coinbase.ID): coinbase}
+
+	// 与区块大小限制相同按固定格式计算, 区块头按最大的大小计算
+	blockSize := maxBlockHeaderSize + len(coinbase.Seialize())
+	sigOps := coinbase.SigOpCount()
+
+	// 未被选择的交易 key: 交易ID
+	skipped := make(map[string]bool)
+
+	for _, tx := range transactions {
+		// 依赖未被选择的交易的输出, 该交易也不能被选择
+		dependsOnSkipped := false
+		for _, vin := range tx.Vin {
+			if skipped[hex.EncodeToString(vin.TXid)] {
+				dependsOnSkipped = true
+				break
+			}
+		}
+
+		// 查找交易花费的输出, 未找到的输出在验证区块交易时拒绝, 此处不计算
+		prevTXs := make(map[string]transaction.Transaction)
+		for _, vin := range tx.Vin {
+			prevOuts, ok := lookupOutputs(utxo, selectedTXs, height, vin.TXid)
+			if prevOut, exists := prevOuts.Outputs[vin.VoutIndex]; ok && exists {
+				addPrevOutput(prevTXs, vin, prevOut)
+			}
+		}
+
+		txSize := len(tx.Seialize())
+		txSigOps := tx.SigOpCount() + tx.P2SHSigOpCount(prevTXs)
+		if dependsOnSkipped || len(selected) >= MaxBlockTransactions ||
+			blockSize + txSize > MaxBlockSize || sigOps + txSigOps > MaxBlockSigOps {
+			skipped[hex.EncodeToString(tx.ID)] = true
+			continue
+		}
+
+		selected = append(selected, tx)
+		selectedTXs[hex.EncodeToString(tx.ID)] = tx
+		blockSize += txSize
+		sigOps += txSigOps
+	}
+
+	return selected
+}
@@ -0,0 +1,137 @@
+/*
+  区块时间规则：时钟接口、网络调整时间以及前若干个区块时间戳的中位数
+*/
+package blockchain
+
+import (
+	"fmt"
+	"github.com/boltdb"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 计算区块时间戳中位数使用的前一区块数量
+const medianTimeBlocks = 11
+
+// 最多保存的其他节点时间样本数量
+const maxTimeSamples = 200
+
+// 网络时间与本地时间最多允许相差70分钟, 超过时不调整本地时间
+const maxAllowedOffset = 70 * 60
+
+// 时钟, 测试时可以替换为可控制的时钟
+type Clock interface {
+	Now() time.Time
+}
+
+// 系统时钟
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// 使用系统时间的时钟
+var SystemClock Clock = systemClock{}
+
+// 网络调整时间: 本地时钟加上其他节点时间与本地时间之差的中位数
+type MedianTimeSource struct {
+	clock   Clock
+	lock    sync.Mutex
+	offsets map[string]int64 // key: 节点的远程主机, value: 节点时间与本地时间之差(秒)
+	offset  int64            // 当前使用的时间偏移(秒)
+}
+
+// 根据时钟构建网络调整时间
+func NewMedianTimeSource(clock Clock) *MedianTimeSource {
+	return &MedianTimeSource{
+		clock:   clock,
+		offsets: make(map[string]int64),
+	}
+}
+
+// 获取本地时钟的当前时间
+func (m *MedianTimeSource) Now() time.Time {
+	return m.clock.Now()
+}
+
+// 获取网络调整后的当前时间
+func (m *MedianTimeSource) AdjustedTime() time.Time {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.clock.Now().Add(time.Duration(m.offset) * time.Second)
+}
+
+// 获取当前使用的时间偏移
+func (m *MedianTimeSource) Offset() time.Duration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return time.Duration(m.offset) * time.Second
+}
+
+/*
+	summary：加入其他节点报告的时间, 每个来源只记录第一次报告的时间, 并重新计算时间偏移
+	source: 节点的远程主机(连接的对端IP), 不能使用节点自己声明的地址, 以免单个节点占满全部样本
+	timestamp: 节点报告的时间
+*/
+func (m *MedianTimeSource) AddTimeSample(source string, timestamp time.Time) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.offsets[source]; ok || len(m.offsets) >= maxTimeSamples {
+		return
+	}
+
+	m.offsets[source] = timestamp.Unix() - m.clock.Now().Unix()
+
+	// 本地时间也作为一个样本(偏移为0)
+	offsets := []int64{0}
+	for _, offset := range m.offsets {
+		offsets = append(offsets, offset)
+	}
+	median := medianInt64(offsets)
+
+	// 偏移过大说明本地时间或其他节点时间有误, 不调整本地时间
+	if median < -maxAllowedOffset || median > maxAllowedOffset {
+		fmt.Printf("其他节点时间与本地时间相差 %d 秒, 超出允许范围, 请检查本地时间\n", median)
+		m.offset = 0
+		return
+	}
+
+	m.offset = median
+}
+
+// 计算中位数, 会对输入排序
+func medianInt64(values []int64) int64 {
+	sort.Slice(values, func(i, j int) bool {
+		return values[i] < values[j]
+	})
+
+	return values[len(values) / 2]
+}
+
+// 计算区块及其之前共11个区块时间戳的中位数, 区块不足11个时使用全部区块
+func calcPastMedianTime(tx *bolt.Tx, block *Block) (int64, error) {
+	timestamps := make([]int64, 0, medianTimeBlocks)
+
+	current := block
+	for i := 0; i < medianTimeBlocks; i++ {
+		timestamps = append(timestamps, int64(current.Time))
+
+		// 创世区块没有前一区块
+		if len(current.PrevBlockHash) == 0 {
+			break
+		}
+
+		prevBlock, err := getBlock(tx, current.PrevBlockHash)
+		if err != nil {
+			return 0, err
+		}
+		current = prevBlock
+	}
+
+	return medianInt64(timestamps), nil
+}
@@ -0,0 +1,169 @@
+/*
+  孤块池，暂存前一区块尚未收到的区块，前一区块到达后自动连接
+*/
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// 孤块池最多保存的孤块数量
+const maxOrphanBlocks = 100
+
+// 孤块在孤块池中的最长保存时间
+const maxOrphanAge = time.Hour
+
+// 孤块: 前一区块尚未收到的区块
+type orphanBlock struct {
+	block      *Block
+	expiration time.Time // 过期时间
+}
+
+/*
+	summary：处理接收到的区块: 前一区块不存在时放入孤块池, 否则加入区块链, 并连接以该区块为前一区块的孤块
+	return: 区块是否为孤块; 区块验证失败时返回错误
+*/
+func (bc *Blockchain) ProcessBlock(block *Block) (bool, error) {
+	bc.chainLock.Lock()
+	defer bc.chainLock.Unlock()
+
+	// 区块已存在于区块链或孤块池中
+	if _, err := bc.GetBlockById(block.Hash); err == nil {
+		return false, nil
+	}
+
+	if bc.isOrphan(block.Hash) {
+		return true, nil
+	}
+
+	// 前一区块不存在, 放入孤块池
+	if _, err := bc.GetBlockById(block.PrevBlockHash); err != nil {
+		// 先验证区块本身, 避免无效的区块占用孤块池
+		err = bc.checkBlockSanity(block)
+		if err != nil {
+			return false, err
+		}
+
+		bc.addOrphan(block)
+		return true, nil
+	}
+
+	err := bc.addBlock(block)
+	if err != nil {
+		return false, err
+	}
+
+	// 连接以该区块为前一区块的孤块
+	bc.processOrphans(block.Hash)
+	return false, nil
+}
+
+// 获取孤块所缺失的最早的前一区块的Hash, 用于向其他节点请求该区块
+func (bc *Blockchain) GetMissingParent(hash []byte) []byte {
+	bc.orphanLock.Lock()
+	defer bc.orphanLock.Unlock()
+
+	// 沿孤块的前一区块往前回溯, 直到前一区块不在孤块池中
+	missing := hash
+	for {
+		orphan, ok := bc.orphans[hex.EncodeToString(missing)]
+		if !ok {
+			return missing
+		}
+
+		missing = orphan.block.PrevBlockHash
+	}
+}
+
+// 判断区块是否在孤块池中
+func (bc *Blockchain) isOrphan(hash []byte) bool {
+	bc.orphanLock.Lock()
+	defer bc.orphanLock.Unlock()
+
+	_, ok := bc.orphans[hex.EncodeToString(hash)]
+	return ok
+}
+
+// 将区块放入孤块池, 放入前先清理过期的孤块, 孤块池已满时淘汰最早过期的孤块
+func (bc *Blockchain) addOrphan(block *Block) {
+	bc.orphanLock.Lock()
+	defer bc.orphanLock.Unlock()
+
+	now := bc.timeSource.Now()
+	var oldest *orphanBlock
+	for _, orphan := range bc.orphans {
+		if now.After(orphan.expiration) {
+			bc.removeOrphan(orphan)
+			continue
+		}
+
+		if oldest == nil || orphan.expiration.Before(oldest.expiration) {
+			oldest = orphan
+		}
+	}
+
+	if len(bc.orphans) >= maxOrphanBlocks && oldest != nil {
+		bc.removeOrphan(oldest)
+	}
+
+	orphan := &orphanBlock{block, now.Add(maxOrphanAge)}
+	bc.orphans[hex.EncodeToString(block.Hash)] = orphan
+
+	prevHash := hex.EncodeToString(block.PrevBlockHash)
+	bc.prevOrphans[prevHash] = append(bc.prevOrphans[prevHash], orphan)
+
+	fmt.Printf("区块 %x 的前一区块 %x 不存在, 放入孤块池, 当前孤块数: %d\n", block.Hash, block.PrevBlockHash, len(bc.orphans))
+}
+
+// 从孤块池中删除孤块, 调用者需持有孤块池的锁
+func (bc *Blockchain) removeOrphan(orphan *orphanBlock) {
+	delete(bc.orphans, hex.EncodeToString(orphan.block.Hash))
+
+	prevHash := hex.EncodeToString(orphan.block.PrevBlockHash)
+	siblings := bc.prevOrphans[prevHash]
+	for i, sibling := range siblings {
+		if bytes.Compare(sibling.block.Hash, orphan.block.Hash) == 0 {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+
+	if len(siblings) == 0 {
+		delete(bc.prevOrphans, prevHash)
+	} else {
+		bc.prevOrphans[prevHash] = siblings
+	}
+}
+
+// 依次连接以指定区块为祖先的孤块
+func (bc *Blockchain) processOrphans(hash []byte) {
+	// 待处理的前一区块Hash队列
+	processHashes := [][]byte{hash}
+
+	for len(processHashes) > 0 {
+		processHash := processHashes[0]
+		processHashes = processHashes[1:]
+
+		// 取出以当前区块为前一区块的孤块
+		bc.orphanLock.Lock()
+		orphans := append([]*orphanBlock{}, bc.prevOrphans[hex.EncodeToString(processHash)]...)
+		for _, orphan := range orphans {
+			bc.removeOrphan(orphan)
+		}
+		bc.orphanLock.Unlock()
+
+		for _, orphan := range orphans {
+			err := bc.addBlock(orphan.block)
+			if err != nil {
+				fmt.Printf("孤块 %x 验证失败: %s\n", orphan.block.Hash, err)
+				continue
+			}
+
+			fmt.Printf("孤块 %x 已连接到区块链\n", orphan.block.Hash)
+			processHashes = append(processHashes, orphan.block.Hash)
+		}
+	}
+}
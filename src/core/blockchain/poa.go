@@ -0,0 +1,229 @@
+/*
+  权威证明共识引擎：由配置的权威节点对区块签名，不需要挖矿；按区块高度轮到的权威节点签名的区块工作量更大，
+  轮到的权威节点离线时其他权威节点可以延迟签名，保证区块链不会因单个权威节点离线而停止
+*/
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"core/chaincfg"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/boltdb"
+	"math/big"
+	"time"
+	"utils"
+)
+
+// 当前节点不是权威节点, 或在最近的区块中已签名过, 暂时不能签名区块
+var ErrNotInTurn = errors.New("当前节点暂时不能签名区块(不是权威节点或最近已签名过区块)")
+
+// 权威证明共识引擎
+type PoAEngine struct {
+	params      *chaincfg.Params  // 网络参数, 未轮到签名的区块难度值为网络的最低难度
+	authorities [][]byte          // 权威节点的公钥, 按轮流签名的顺序排列
+	inTurnBits  int32             // 轮到签名的区块的难度值, 目标值为最低难度的一半, 即工作量为未轮到签名的区块的两倍
+	signer      *ecdsa.PrivateKey // 当前节点用于签名的私钥, 为nil表示只验证区块
+	signerIndex int               // 当前节点在权威节点中的序号, 不是权威节点时为-1
+}
+
+/*
+	summary：构建权威证明共识引擎
+	params: 网络参数
+	authorities: 权威节点公钥的16进制字符串, 高度为height的区块轮到第 height % len(authorities) 个权威节点签名
+	signer: 当前节点用于签名的私钥, 为nil表示只验证区块
+*/
+func NewPoAEngine(params *chaincfg.Params, authorities []string, signer *ecdsa.PrivateKey) (*PoAEngine, error) {
+	if len(authorities) == 0 {
+		return nil, errors.New("权威节点不能为空")
+	}
+
+	inTurnTarget := new(big.Int).Rsh(params.PowLimit(), 1)
+	engine := &PoAEngine{params: params, inTurnBits: int32(utils.BigToCompact(inTurnTarget)), signer: signer, signerIndex: -1}
+	for _, authority := range authorities {
+		pubkey, err := hex.DecodeString(authority)
+		if err != nil || len(pubkey) != 64 {
+			return nil, fmt.Errorf("权威节点公钥 %s 格式错误", authority)
+		}
+
+		engine.authorities = append(engine.authorities, pubkey)
+	}
+
+	if signer != nil {
+		signerKey := append(utils.PaddedBytes(signer.PublicKey.X, 32), utils.PaddedBytes(signer.PublicKey.Y, 32)...)
+		for i, authority := range engine.authorities {
+			if bytes.Equal(authority, signerKey) {
+				engine.signerIndex = i
+			}
+		}
+	}
+
+	return engine, nil
+}
+
+// 获取指定高度的区块轮到签名的权威节点序号
+func (engine *PoAEngine) inTurnIndex(height int32) int {
+	index := int(height) % len(engine.authorities)
+	if index < 0 {
+		index += len(engine.authorities)
+	}
+
+	return index
+}
+
+// 获取第index个权威节点签名的指定高度的区块的难度值, 轮到签名时工作量更大
+func (engine *PoAEngine) bitsFor(height int32, index int) int32 {
+	if index == engine.inTurnIndex(height) {
+		return engine.inTurnBits
+	}
+
+	return engine.params.PowLimitBits
+}
+
+// 权威节点在连续多少个区块中只能签名一个, 超过半数的权威节点才能延续区块链
+func (engine *PoAEngine) signerLimit() int {
+	return len(engine.authorities) / 2 + 1
+}
+
+// 根据区块的签名获取签名的权威节点序号, 不是由权威节点签名时返回RuleError
+func (engine *PoAEngine) blockSigner(block *Block) (int, error) {
+	if len(block.Signature) != 64 {
+		return -1, ruleError(ErrBadBlockSignature, fmt.Sprintf("区块 %x 的签名格式错误", block.Hash))
+	}
+
+	r := new(big.Int).SetBytes(block.Signature[:32])
+	s := new(big.Int).SetBytes(block.Signature[32:])
+
+	// 根据权威节点的公钥构建椭圆曲线公钥, 公钥由x和y拼接而成
+	for i, authority := range engine.authorities {
+		pubkey := ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(authority[:32]),
+			Y:     new(big.Int).SetBytes(authority[32:]),
+		}
+
+		if ecdsa.Verify(&pubkey, block.Hash, r, s) {
+			return i, nil
+		}
+	}
+
+	return -1, ruleError(ErrBadBlockSignature, fmt.Sprintf("区块 %x 不是由权威节点签名的", block.Hash))
+}
+
+// 第index个权威节点是否签名了prevBlock及其之前共signerLimit-1个区块中的任意一个
+func (engine *PoAEngine) recentlySigned(tx *bolt.Tx, prevBlock *Block, index int) (bool, error) {
+	block := prevBlock
+	for i := 0; i < engine.signerLimit() - 1; i++ {
+		// 创世区块没有签名
+		if len(block.PrevBlockHash) == 0 {
+			return false, nil
+		}
+
+		signer, err := engine.blockSigner(block)
+		if err != nil {
+			return false, err
+		}
+
+		if signer == index {
+			return true, nil
+		}
+
+		block, err = getBlock(tx, block.PrevBlockHash)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// 当前节点为下一区块签名时的难度值; 当前节点不是权威节点或最近已签名过区块时返回ErrNotInTurn
+func (engine *PoAEngine) CalcDifficulty(tx *bolt.Tx, prevBlock *Block) (int32, error) {
+	if engine.signer == nil || engine.signerIndex < 0 {
+		return 0, ErrNotInTurn
+	}
+
+	recent, err := engine.recentlySigned(tx, prevBlock, engine.signerIndex)
+	if err != nil {
+		return 0, err
+	}
+
+	if recent {
+		return 0, ErrNotInTurn
+	}
+
+	return engine.bitsFor(prevBlock.Height + 1, engine.signerIndex), nil
+}
+
+// 使用当前节点的私钥对区块头的Hash签名; 未轮到当前节点时先等待一个出块时间, 期间收到新区块则取消签名
+func (engine *PoAEngine) Seal(ctx context.Context, block *Block) error {
+	if engine.signer == nil || engine.signerIndex < 0 {
+		return ErrNotInTurn
+	}
+
+	if engine.signerIndex != engine.inTurnIndex(block.Height) {
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Duration(engine.params.TargetBlockTime) * time.Second):
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ErrMiningCanceled
+	}
+
+	block.Bits = engine.bitsFor(block.Height, engine.signerIndex)
+	block.Nonce = 0
+	block.Hash = block.HeaderHash()
+
+	r, s, err := ecdsa.Sign(rand.Reader, engine.signer, block.Hash)
+	if err != nil {
+		return err
+	}
+
+	// 签名由 r + s 拼接而成, r和s各补齐为32个字节
+	block.Signature = append(utils.PaddedBytes(r, 32), utils.PaddedBytes(s, 32)...)
+	return nil
+}
+
+// 验证区块的Hash与区块头一致, 由权威节点签名, 且难度值与签名节点是否轮到签名一致
+func (engine *PoAEngine) VerifyHeader(block *Block) error {
+	if !bytes.Equal(block.HeaderHash(), block.Hash) {
+		return ruleError(ErrHighHash, fmt.Sprintf("区块 %x 的Hash与区块头不一致", block.Hash))
+	}
+
+	index, err := engine.blockSigner(block)
+	if err != nil {
+		return err
+	}
+
+	if bits := engine.bitsFor(block.Height, index); block.Bits != bits {
+		return ruleError(ErrBadBits, fmt.Sprintf("区块 %x 的难度值 %08x 与权威节点 %x 在高度 %d 签名的难度值 %08x 不一致", block.Hash, block.Bits, engine.authorities[index], block.Height, bits))
+	}
+
+	return nil
+}
+
+// 验证签名的权威节点在最近的区块中没有签名过, 防止少数权威节点单独延续区块链
+func (engine *PoAEngine) VerifyContext(tx *bolt.Tx, prevBlock *Block, block *Block) error {
+	index, err := engine.blockSigner(block)
+	if err != nil {
+		return err
+	}
+
+	recent, err := engine.recentlySigned(tx, prevBlock, index)
+	if err != nil {
+		return err
+	}
+
+	if recent {
+		return ruleError(ErrRecentSigner, fmt.Sprintf("权威节点 %x 在最近 %d 个区块中已签名过, 不能签名区块 %x", engine.authorities[index], engine.signerLimit() - 1, block.Hash))
+	}
+
+	return nil
+}
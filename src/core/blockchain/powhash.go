@@ -0,0 +1,63 @@
+/*
+  工作量证明的哈希算法：默认使用双重SHA256，也可以通过网络参数选择适合CPU挖矿的内存困难算法scrypt或Argon2id
+  区块的Hash（区块的标识）始终为区块头的双重SHA256，工作量证明算法只用于判断区块头是否满足难度
+*/
+package blockchain
+
+import (
+	"core/chaincfg"
+	"crypto/sha256"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+	"log"
+)
+
+// 工作量证明哈希算法输出的字节数
+const powHashSize = 32
+
+// 工作量证明哈希函数, 输入区块头的序列化数据, 输出32个字节的hash值
+type PowHashFunc func(header []byte) []byte
+
+// 双重SHA256
+func doubleSHA256(data []byte) []byte {
+	firstHash := sha256.Sum256(data)
+	secondHash := sha256.Sum256(firstHash[:])
+	return secondHash[:]
+}
+
+// 根据网络参数构建工作量证明哈希函数, 算法参数无效时返回错误
+func NewPowHashFunc(params *chaincfg.Params) (PowHashFunc, error) {
+	switch params.PowAlgorithm {
+	case chaincfg.PowSHA256d, "":
+		return doubleSHA256, nil
+	case chaincfg.PowScrypt:
+		n, r, p := params.PowScrypt.N, params.PowScrypt.R, params.PowScrypt.P
+
+		// 提前验证参数, 挖矿及验证时不会再出错
+		_, err := scrypt.Key([]byte{}, []byte{}, n, r, p, powHashSize)
+		if err != nil {
+			return nil, fmt.Errorf("scrypt参数无效: %s", err)
+		}
+
+		// 与莱特币相同, 区块头同时作为密码和盐
+		return func(header []byte) []byte {
+			hash, err := scrypt.Key(header, header, n, r, p, powHashSize)
+			if err != nil {
+				log.Panic(err)
+			}
+			return hash
+		}, nil
+	case chaincfg.PowArgon2id:
+		argon2Params := params.PowArgon2
+		if argon2Params.Time == 0 || argon2Params.Threads == 0 || argon2Params.Memory < 8 * uint32(argon2Params.Threads) {
+			return nil, fmt.Errorf("Argon2id参数无效: %+v", argon2Params)
+		}
+
+		return func(header []byte) []byte {
+			return argon2.IDKey(header, header, argon2Params.Time, argon2Params.Memory, argon2Params.Threads, powHashSize)
+		}, nil
+	default:
+		return nil, fmt.Errorf("未知的工作量证明算法: %s", params.PowAlgorithm)
+	}
+}
@@ -5,28 +5,66 @@ package blockchain
 
 import (
 	"bytes"
-	"crypto/sha256"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
 	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 	"utils"
 )
 
-// 挖矿难度
-const targetBits = 16
+// 挖矿使用的协程数, 默认使用全部CPU核心
+var MinerThreads = runtime.NumCPU()
+
+// 每个协程大约每隔多长时间检查一次是否停止挖矿, 并累计算力
+const miningCheckInterval = 50 * time.Millisecond
+
+// 每批次最多计算的hash次数, 批次大小根据工作量证明算法的计算速度自动调整
+const maxHashBatchSize = 1 << 16
+
+// 打印算力的时间间隔
+const hashrateInterval = 5 * time.Second
+
+// 挖矿被取消（例如收到了竞争区块）
+var ErrMiningCanceled = errors.New("挖矿已被取消")
+
+// 32位随机数空间已全部尝试, 未找到满足难度的hash值
+var ErrNonceExhausted = errors.New("随机数空间已用尽")
+
+// 挖矿协程找到的结果
+type miningResult struct {
+	nonce int32
+	hash []byte
+}
 
 type ProofOfWork struct {
 	block *Block
 	target *big.Int  // 目标值
+	powHash PowHashFunc  // 工作量证明哈希函数
 }
 
+// 使用双重SHA256作为工作量证明哈希算法
 func NewProofOfWork(block *Block) *ProofOfWork {
-	// 用大整数标识目标值
-	target := big.NewInt(1)
-	// 将目标值左移相应位数，标识挖矿难度
-	target.Lsh(target, uint(256 - targetBits))
-	//fmt.Printf("当前目标值：%x\n", target.Bytes())
+	return NewProofOfWorkWithHash(block, doubleSHA256)
+}
+
+// 使用指定的工作量证明哈希算法
+func NewProofOfWorkWithHash(block *Block, powHash PowHashFunc) *ProofOfWork {
+	// 根据区块头中压缩格式的难度值Bits解码得到目标值
+	target, negative, overflow := utils.CompactToBig(uint32(block.Bits))
+
+	// 目标值为负数、溢出或为0均无效, 置为0使任何hash值都无法满足
+	if negative || overflow || target.Sign() <= 0 {
+		target = big.NewInt(0)
+	}
 
 	// 根据区块和当前区块挖矿难度初始化POW
-	pow := &ProofOfWork{block, target}
+	pow := &ProofOfWork{block, target, powHash}
 	return pow
 }
 
@@ -44,48 +82,170 @@ func (pow *ProofOfWork) Serialize(nonce int32) []byte {
 	return data
 }
 
-// 挖矿函数
+// 挖矿函数, 使用全部CPU核心挖矿
 func (pow *ProofOfWork) Mine() (int32, []byte) {
-	var nonce int32 = 0
-	var currentHash [32]byte
-	var bIntCurrent big.Int
+	nonce, hash, err := pow.MineWithContext(context.Background(), MinerThreads)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return nonce, hash
+}
+
+/*
+	summary：多协程挖矿, 将32位随机数空间平均分给每个协程, 可通过上下文取消挖矿
+	ctx: 挖矿的上下文, 取消后所有协程停止挖矿
+	threads: 挖矿使用的协程数
+	return: 满足难度的随机数Nonce; 对应的区块Hash; 挖矿被取消或随机数空间已用尽时返回错误
+*/
+func (pow *ProofOfWork) MineWithContext(ctx context.Context, threads int) (int32, []byte, error) {
+	// 无效的目标值永远无法挖矿成功
+	if pow.target.Sign() == 0 {
+		return 0, nil, errors.New("区块的难度值Bits无效，无法挖矿！")
+	}
+
+	if threads < 1 {
+		threads = 1
+	}
+
+	// 任一协程找到结果后, 通过该上下文通知其余协程停止
+	workCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	// 已计算的hash次数, 用于统计算力
+	var hashes uint64
+	results := make(chan miningResult, threads)
+	var wg sync.WaitGroup
+
+	// 将随机数空间[0, 2^32)平均分给每个协程
+	const nonceSpace = uint64(1) << 32
+	step := nonceSpace / uint64(threads)
+	for i := 0; i < threads; i++ {
+		start := uint64(i) * step
+		end := start + step
+		if i == threads - 1 {
+			end = nonceSpace
+		}
+
+		wg.Add(1)
+		go func(start, end uint64) {
+			defer wg.Done()
+			pow.mineRange(workCtx, start, end, &hashes, results)
+		}(start, end)
+	}
+
+	// 所有协程结束后关闭结果通道
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	startTime := time.Now()
+	ticker := time.NewTicker(hashrateInterval)
+	defer ticker.Stop()
 
 	for {
-		// 序列化当前区块
-		data := pow.Serialize(nonce)
-		// double hash
-		firstHash := sha256.Sum256(data)
-		currentHash = sha256.Sum256(firstHash[:])
+		select {
+		case result, ok := <-results:
+			printHashrate(atomic.LoadUint64(&hashes), time.Since(startTime))
+
+			// 通道关闭表示所有协程都已结束但未找到结果
+			if !ok {
+				if ctx.Err() != nil {
+					return 0, nil, ErrMiningCanceled
+				}
+				return 0, nil, ErrNonceExhausted
+			}
+
+			return result.nonce, result.hash, nil
+		case <-ticker.C:
+			// 定时打印当前算力
+			printHashrate(atomic.LoadUint64(&hashes), time.Since(startTime))
+		}
+	}
+}
+
+/*
+	summary：在随机数区间[start, end)内挖矿, 找到结果后写入结果通道
+	每计算一批hash检查一次是否需要停止, 并累计算力; 批次大小从1开始, 根据每批次的耗时调整,
+	使各种工作量证明算法(sha256d较快, scrypt/argon2id较慢)都大约每隔miningCheckInterval检查一次
+*/
+func (pow *ProofOfWork) mineRange(ctx context.Context, start, end uint64, hashes *uint64, results chan<- miningResult) {
+	var bIntCurrent big.Int
 
-		// 打印当前挖矿过程
-		//fmt.Printf("%x\n", currentHash)
+	// 序列化区块头, 随机数位于最后4个字节, 挖矿时只需替换随机数
+	data := pow.Serialize(0)
+	nonceBytes := data[len(data) - 4:]
 
-		// 将当前hash转为大整型
-		bIntCurrent.SetBytes(currentHash[:])
+	batchSize := uint64(1)
+	var batchCount uint64
+	batchStart := time.Now()
+	for n := start; n < end; n++ {
+		binary.LittleEndian.PutUint32(nonceBytes, uint32(n))
 
-		// 和目标值比较, 小于当前POW的目标值则挖矿成功
+		// 工作量证明hash
+		currentHash := pow.powHash(data)
+		batchCount++
+
+		// 将当前hash转为大整型, 和目标值比较, 小于当前POW的目标值则挖矿成功, 区块的Hash为区块头的双重SHA256
+		bIntCurrent.SetBytes(currentHash)
 		if bIntCurrent.Cmp(pow.target) == -1 {
-			break
-		} else {
-			nonce++
+			atomic.AddUint64(hashes, batchCount)
+			results <- miningResult{int32(uint32(n)), doubleSHA256(data)}
+			return
+		}
+
+		if batchCount < batchSize {
+			continue
+		}
+
+		atomic.AddUint64(hashes, batchCount)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// 本批次耗时过短则加大批次, 过长则减小批次
+		elapsed := time.Since(batchStart)
+		if elapsed < miningCheckInterval / 2 && batchSize < maxHashBatchSize {
+			batchSize *= 2
+		} else if elapsed > miningCheckInterval && batchSize > 1 {
+			batchSize /= 2
 		}
+		batchCount = 0
+		batchStart = time.Now()
 	}
 
-	return nonce, currentHash[:]
+	atomic.AddUint64(hashes, batchCount)
 }
 
-// 验证是否小于当前目标值
-func (pow *ProofOfWork) Validate() bool {
-	var hasInt big.Int
+// 打印挖矿的算力
+func printHashrate(hashes uint64, elapsed time.Duration) {
+	if elapsed <= 0 {
+		return
+	}
+
+	fmt.Printf("已计算hash: %d, 当前算力: %.2f H/s\n", hashes, float64(hashes) / elapsed.Seconds())
+}
+
+// 计算当前区块头的hash值, 即区块的Hash
+func (pow *ProofOfWork) Hash() []byte {
 	data := pow.Serialize(pow.block.Nonce)
 
 	// double hash
-	firstHash := sha256.Sum256(data)
-	secondHash := sha256.Sum256(firstHash[:])
-	hasInt.SetBytes(secondHash[:])
+	return doubleSHA256(data)
+}
+
+// 计算当前区块头的工作量证明hash值
+func (pow *ProofOfWork) PowHash() []byte {
+	return pow.powHash(pow.Serialize(pow.block.Nonce))
+}
+
+// 验证工作量证明hash值是否小于当前目标值
+func (pow *ProofOfWork) Validate() bool {
+	var hasInt big.Int
+	hasInt.SetBytes(pow.PowHash())
 
 	// 验证当前hash值是否小于目标值
 	isValidate := hasInt.Cmp(pow.target) == -1
 	return isValidate
 }
-
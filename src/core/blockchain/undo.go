@@ -0,0 +1,140 @@
+/*
+  区块的撤销数据，记录区块花费的输出，用于分叉链切换时回滚UTXO
+*/
+package blockchain
+
+import (
+	"bytes"
+	"core/transaction"
+	"encoding/gob"
+	"fmt"
+	"github.com/boltdb"
+	"log"
+)
+
+// 存放区块撤销数据的桶 key: 区块Hash, value: 区块花费的全部输出的序列化
+const undoBucket = "undo"
+
+// 区块中被花费的输出
+type SpentOutput struct {
+	TXid       []byte               // 输出所在的交易ID
+	VoutIndex  int                  // 输出在交易中的序号
+	Output     transaction.TXOutput // 被花费的输出
+	Height     int32                // 输出所在交易的区块高度
+	IsCoinbase bool                 // 输出所在交易是否为coinbase交易
+}
+
+// 序列化区块的撤销数据
+func serializeUndo(spentOutputs []SpentOutput) []byte {
+	var buff bytes.Buffer
+	enc := gob.NewEncoder(&buff)
+	err := enc.Encode(spentOutputs)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return buff.Bytes()
+}
+
+// 反序列化区块的撤销数据
+func deserializeUndo(data []byte) []SpentOutput {
+	var spentOutputs []SpentOutput
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	err := dec.Decode(&spentOutputs)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return spentOutputs
+}
+
+/*
+	summary：将区块连接到当前最新区块之后: 验证区块中的交易, 更新UTXO, 记录撤销数据, 并更新最新区块
+	区块的前一区块必须是当前最新区块, 假定有效区块及其祖先区块不验证交易签名
+*/
+func (bc *Blockchain) connectBlock(tx *bolt.Tx, block *Block) error {
+	assumedValid, err := bc.isAssumedValid(tx, block)
+	if err != nil {
+		return err
+	}
+
+	// 根据UTXO验证区块中的交易
+	_, err = bc.checkBlockTransactions(tx, block, !assumedValid)
+	if err != nil {
+		return err
+	}
+
+	// 更新UTXO, 并得到区块花费的全部输出
+	spentOutputs, err := updateUTXOWithBlock(tx.Bucket([]byte(utxoBucket)), block)
+	if err != nil {
+		return err
+	}
+
+	// 记录撤销数据
+	err = tx.Bucket([]byte(undoBucket)).Put(block.Hash, serializeUndo(spentOutputs))
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket([]byte(blockBucket)).Put([]byte("l"), block.Hash)
+}
+
+/*
+	summary：将当前最新区块从区块链上断开: 根据撤销数据回滚UTXO, 并将最新区块更新为其前一区块
+	区块必须是当前最新区块
+*/
+func disconnectBlock(tx *bolt.Tx, block *Block) error {
+	utxo := tx.Bucket([]byte(utxoBucket))
+	undo := tx.Bucket([]byte(undoBucket))
+
+	undoData := undo.Get(block.Hash)
+	if undoData == nil {
+		return fmt.Errorf("未找到区块 %x 的撤销数据", block.Hash)
+	}
+	spentOutputs := deserializeUndo(undoData)
+
+	// 倒序遍历区块的交易, 同一区块中后面的交易可能花费了前面交易的输出
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		blockTx := block.Transactions[i]
+
+		// 删除交易产生的输出
+		err := utxo.Delete(blockTx.ID)
+		if err != nil {
+			return err
+		}
+
+		if blockTx.IsCoinBase() {
+			continue
+		}
+
+		// 撤销数据按输入的顺序记录, 当前交易花费的输出位于剩余撤销数据的末尾
+		if len(spentOutputs) < len(blockTx.Vin) {
+			return fmt.Errorf("区块 %x 的撤销数据不完整", block.Hash)
+		}
+		txSpent := spentOutputs[len(spentOutputs) - len(blockTx.Vin):]
+		spentOutputs = spentOutputs[:len(spentOutputs) - len(blockTx.Vin)]
+
+		// 将交易花费的输出重新放回UTXO
+		for _, spent := range txSpent {
+			outs := transaction.NewTXOutputs()
+			if outsBytes := utxo.Get(spent.TXid); outsBytes != nil {
+				outs = transaction.DeserializeOutputs(outsBytes)
+			}
+			outs.Height = spent.Height
+			outs.IsCoinbase = spent.IsCoinbase
+
+			outs.Outputs[spent.VoutIndex] = spent.Output
+			err = utxo.Put(spent.TXid, transaction.SerializeOutputs(outs))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := undo.Delete(block.Hash)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket([]byte(blockBucket)).Put([]byte("l"), block.PrevBlockHash)
+}
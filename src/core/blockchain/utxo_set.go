@@ -3,6 +3,7 @@ package blockchain
 import (
 	"core/transaction"
 	"encoding/hex"
+	"fmt"
 	"github.com/boltdb"
 	"log"
 )
@@ -109,67 +110,148 @@ func (u UTXOSet) FindUTXOByPubkeyHash(pubkeyHash []byte) []transaction.TXOutput
 	return UTXOs
 }
 
-// 通过一个区块更新数据库中的UTXO（在生成或接受一个新的区块时使用）
-func (u UTXOSet) UpdateUTXOByBlock(block *Block) {
-	db := u.bc.db
-	err := db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket([]byte(utxoBucket))
+/*
+	summary：根据公钥Hash获取对应公钥的余额, 按下一个区块的高度判断coinbase输出是否成熟
+	return: 可花费的金额； 未成熟的coinbase输出的金额
+*/
+func (u UTXOSet) GetBalanceByPubkeyHash(pubkeyHash []byte) (int, int) {
+	spendable := 0
+	immature := 0
 
-		// 循环遍历区块的所有交易
-		for _, tx := range block.Transactions {
-			// 如果交易不是Coinbase交易
-			if tx.IsCoinBase() == false {
-				// 循环遍历交易的输入
-				for _, vin := range tx.Vin {
-					// 存放当前输入所引用的输出所在的交易的所有输出
-					updateOuts := transaction.TXOutputs{}
-
-					// 获取当前输入对应的输出所在交易所有未花费的输出的序列化
-					outsBytes := bucket.Get(vin.TXid)
-					// 反序列化交易所有未花费的输出
-					outs := transaction.DeserializeOutputs(outsBytes)
-
-					// 循环遍历交易的输出
-					for outIdx, out := range outs.Outputs {
-						// 如果输出的ID不等于当前交易输入所引用的输出, 则记录未花费输出
-						if outIdx != vin.VoutIndex {
-							updateOuts.Outputs = append(updateOuts.Outputs, out)
-						}
-					}
+	err := u.bc.db.View(func(tx *bolt.Tx) error {
+		lastBlock, err := getBlock(tx, u.bc.GetCurrentHash())
+		if err != nil {
+			return err
+		}
+		height := lastBlock.Height + 1
 
-					// 如果为0表示当前交易的所有输出已被花费, 则从数据库中删除该交易的UTXO
-					if len(updateOuts.Outputs) == 0 {
-						err := bucket.Delete(vin.TXid)
-						if err != nil {
-							return err
-						}
-					} else {
-						// 存在未花费输出则记录数据库
-						err := bucket.Put(vin.TXid, transaction.SerializeOutputs(updateOuts))
-						if err != nil {
-							return err
-						}
-					}
+		// 循环遍历当前桶  key: 交易ID, Value: 当前交易所有未花费的输出的序列化
+		cursor := tx.Bucket([]byte(utxoBucket)).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			outs := transaction.DeserializeOutputs(value)
+			mature := outs.IsMature(height, u.bc.params.CoinbaseMaturity)
+
+			for _, out := range outs.Outputs {
+				if !out.CanBeUnlockedWith(pubkeyHash) {
+					continue
 				}
-			}
 
-			// 当前区块的交易所有输出均是未花费的输出, 存入数据库
-			newOutputs := transaction.TXOutputs{}
-			for _, out := range tx.Vout {
-				newOutputs.Outputs = append(newOutputs.Outputs, out)
+				if mature {
+					spendable += out.Value
+				} else {
+					immature += out.Value
+				}
 			}
+		}
 
-			err := bucket.Put(tx.ID, transaction.SerializeOutputs(newOutputs))
-			if err != nil {
-				return err
+		return nil
+	})
+
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return spendable, immature
+}
+
+/*
+	summary：查找尚未打包的交易的输入所引用的未花费输出集合, 用于交易池验证交易
+	return: 引用的交易在UTXO桶中的未花费输出集合 key: 交易ID的16进制字符串; 下一个区块的高度
+*/
+func (u UTXOSet) FetchInputOutputs(t *transaction.Transaction) (map[string]transaction.TXOutputs, int32, error) {
+	outputs := make(map[string]transaction.TXOutputs)
+	var height int32
+
+	err := u.bc.db.View(func(tx *bolt.Tx) error {
+		// 交易最早被打包进下一个区块, 按下一个区块的高度判断coinbase输出是否成熟
+		lastBlock, err := getBlock(tx, u.bc.GetCurrentHash())
+		if err != nil {
+			return err
+		}
+		height = lastBlock.Height + 1
+
+		bucket := tx.Bucket([]byte(utxoBucket))
+		for _, vin := range t.Vin {
+			outsBytes := bucket.Get(vin.TXid)
+			if outsBytes != nil {
+				outputs[hex.EncodeToString(vin.TXid)] = transaction.DeserializeOutputs(outsBytes)
 			}
 		}
 
 		return nil
 	})
 
+	return outputs, height, err
+}
+
+// 判断交易是否还有未花费的输出, 即交易已经被打包进主链
+func (u UTXOSet) HasUnspentOutputs(txID []byte) bool {
+	found := false
+	err := u.bc.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket([]byte(utxoBucket)).Get(txID) != nil
+		return nil
+	})
 
 	if err != nil {
 		log.Panic(err)
 	}
+
+	return found
+}
+
+/*
+	summary：在数据库事务中根据区块更新UTXO桶: 删除区块交易输入所引用的输出, 加入区块交易的全部输出
+	return: 区块花费的全部输出(按交易及输入的顺序), 作为区块的撤销数据
+*/
+func updateUTXOWithBlock(bucket *bolt.Bucket, block *Block) ([]SpentOutput, error) {
+	var spentOutputs []SpentOutput
+
+	// 循环遍历区块的所有交易
+	for _, tx := range block.Transactions {
+		// 如果交易不是Coinbase交易
+		if tx.IsCoinBase() == false {
+			// 循环遍历交易的输入
+			for _, vin := range tx.Vin {
+				// 获取当前输入对应的输出所在交易所有未花费的输出的序列化
+				outsBytes := bucket.Get(vin.TXid)
+				if outsBytes == nil {
+					return nil, fmt.Errorf("交易 %x 的输出不存在或已全部花费", vin.TXid)
+				}
+
+				// 反序列化交易所有未花费的输出, 记录并删除当前输入所引用的输出
+				outs := transaction.DeserializeOutputs(outsBytes)
+				spentOutputs = append(spentOutputs, SpentOutput{vin.TXid, vin.VoutIndex, outs.Outputs[vin.VoutIndex], outs.Height, outs.IsCoinbase})
+				delete(outs.Outputs, vin.VoutIndex)
+
+				// 如果为0表示当前交易的所有输出已被花费, 则从数据库中删除该交易的UTXO
+				if len(outs.Outputs) == 0 {
+					err := bucket.Delete(vin.TXid)
+					if err != nil {
+						return nil, err
+					}
+				} else {
+					// 存在未花费输出则记录数据库
+					err := bucket.Put(vin.TXid, transaction.SerializeOutputs(outs))
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+
+		// 当前区块的交易所有输出均是未花费的输出, 存入数据库(同时记录区块高度及是否为coinbase交易, 用于判断输出是否成熟)
+		newOutputs := transaction.NewTXOutputs()
+		newOutputs.Height = block.Height
+		newOutputs.IsCoinbase = tx.IsCoinBase()
+		for outIdx, out := range tx.Vout {
+			newOutputs.Outputs[outIdx] = out
+		}
+
+		err := bucket.Put(tx.ID, transaction.SerializeOutputs(newOutputs))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return spentOutputs, nil
 }
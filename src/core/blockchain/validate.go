@@ -0,0 +1,397 @@
+/*
+  区块验证，区块加入区块链之前必须通过全部共识规则的验证
+*/
+package blockchain
+
+import (
+	"bytes"
+	"core/chaincfg"
+	"core/transaction"
+	"encoding/hex"
+	"fmt"
+	"github.com/boltdb"
+	"utils"
+)
+
+// 区块的时间戳最多允许超前网络调整时间2小时
+const maxTimeOffset = 2 * 60 * 60
+
+/*
+	summary：验证区块是否满足全部共识规则
+	前一区块为当前最新区块时, 会根据UTXO验证区块中的交易; 否则区块位于分叉链上, 只验证区块本身及其与前一区块的关系
+	return: 验证失败时返回RuleError
+*/
+func (bc *Blockchain) ValidateBlock(block *Block) error {
+	return bc.db.View(func(tx *bolt.Tx) error {
+		return bc.validateBlock(tx, block)
+	})
+}
+
+// 在数据库事务中验证区块
+func (bc *Blockchain) validateBlock(tx *bolt.Tx, block *Block) error {
+	err := bc.checkBlock(tx, block)
+	if err != nil {
+		return err
+	}
+
+	// 前一区块为最新区块时, UTXO桶对应前一区块的状态, 可以验证区块中的交易
+	lastHash := tx.Bucket([]byte(blockBucket)).Get([]byte("l"))
+	if bytes.Compare(lastHash, block.PrevBlockHash) == 0 {
+		_, err = bc.checkBlockTransactions(tx, block, true)
+		return err
+	}
+
+	return nil
+}
+
+// 验证区块本身及其与前一区块的关系, 不验证区块中交易的输入(连接区块时验证)
+func (bc *Blockchain) checkBlock(tx *bolt.Tx, block *Block) error {
+	// 验证区块本身
+	err := bc.checkBlockSanity(block)
+	if err != nil {
+		return err
+	}
+
+	// 验证区块与前一区块的关系
+	prevBlock, err := getBlock(tx, block.PrevBlockHash)
+	if err != nil {
+		return ruleError(ErrMissingParent, fmt.Sprintf("未找到区块 %x 的前一区块 %x", block.Hash, block.PrevBlockHash))
+	}
+
+	return bc.checkBlockContext(tx, block, prevBlock)
+}
+
+// 验证区块本身, 不依赖区块链中的其他区块, 区块时间戳根据网络调整时间验证
+func (bc *Blockchain) checkBlockSanity(block *Block) error {
+	// 通过共识引擎验证区块头(工作量证明或权威节点的签名)
+	err := bc.engine.VerifyHeader(block)
+	if err != nil {
+		return err
+	}
+
+	// 区块的时间戳不能超前网络调整时间太多
+	maxTimestamp := bc.timeSource.AdjustedTime().Unix() + maxTimeOffset
+	if int64(block.Time) > maxTimestamp {
+		return ruleError(ErrTimeTooNew, fmt.Sprintf("区块 %x 的时间戳 %d 超前网络调整时间太多, 最大允许 %d", block.Hash, block.Time, maxTimestamp))
+	}
+
+	// 区块中至少要有一笔coinbase交易
+	if len(block.Transactions) == 0 {
+		return ruleError(ErrNoTransactions, fmt.Sprintf("区块 %x 中没有交易", block.Hash))
+	}
+
+	// 区块的交易数量、按固定格式计算的大小及签名操作数量不能超过限制
+	if len(block.Transactions) > MaxBlockTransactions {
+		return ruleError(ErrTooManyTransactions, fmt.Sprintf("区块 %x 的交易数量 %d 超过限制 %d", block.Hash, len(block.Transactions), MaxBlockTransactions))
+	}
+
+	if blockSize := block.Size(); blockSize > MaxBlockSize {
+		return ruleError(ErrBlockTooBig, fmt.Sprintf("区块 %x 的大小 %d 超过限制 %d", block.Hash, blockSize, MaxBlockSize))
+	}
+
+	if sigOps := countBlockSigOps(block); sigOps > MaxBlockSigOps {
+		return ruleError(ErrTooManySigOps, fmt.Sprintf("区块 %x 的签名操作数量 %d 超过限制 %d", block.Hash, sigOps, MaxBlockSigOps))
+	}
+
+	// 第一笔交易必须是coinbase交易, 且只能有一笔coinbase交易
+	if !block.Transactions[0].IsCoinBase() {
+		return ruleError(ErrFirstTxNotCoinbase, fmt.Sprintf("区块 %x 的第一笔交易不是coinbase交易", block.Hash))
+	}
+
+	existingTXs := make(map[string]bool)
+	for i, tx := range block.Transactions {
+		if i > 0 && tx.IsCoinBase() {
+			return ruleError(ErrMultipleCoinbases, fmt.Sprintf("区块 %x 中存在多笔coinbase交易", block.Hash))
+		}
+
+		// 交易的ID必须是交易内容的Hash
+		if bytes.Compare(tx.ID, tx.Hash()) != 0 {
+			return ruleError(ErrBadTxID, fmt.Sprintf("交易 %x 的ID与交易内容不一致", tx.ID))
+		}
+
+		// 区块中不能有重复的交易
+		txID := hex.EncodeToString(tx.ID)
+		if existingTXs[txID] {
+			return ruleError(ErrDuplicateTx, fmt.Sprintf("区块 %x 中存在重复的交易 %s", block.Hash, txID))
+		}
+		existingTXs[txID] = true
+
+		// 交易的每个输出及输出总金额都不能超出金额范围
+		err := CheckTransactionSanity(bc.params, tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 区块头的默克尔根必须与区块中的交易一致
+	if !block.VerifyMerkleRoot() {
+		return ruleError(ErrBadMerkleRoot, fmt.Sprintf("区块 %x 的默克尔根与区块中的交易不一致", block.Hash))
+	}
+
+	return nil
+}
+
+// 验证区块的工作量证明, 目标值不能超过网络的最低难度对应的目标值, 工作量证明hash使用网络的工作量证明算法计算
+func checkProofOfWork(block *Block, params *chaincfg.Params, powHash PowHashFunc) error {
+	// 目标值不能超过最低难度对应的目标值
+	target, negative, overflow := utils.CompactToBig(uint32(block.Bits))
+	if negative || overflow || target.Sign() <= 0 || target.Cmp(params.PowLimit()) > 0 {
+		return ruleError(ErrUnexpectedDifficulty, fmt.Sprintf("区块 %x 的难度值 %08x 超出范围", block.Hash, block.Bits))
+	}
+
+	// 区块的Hash必须与区块头一致, 且满足其声明的难度
+	pow := NewProofOfWorkWithHash(block, powHash)
+	if bytes.Compare(pow.Hash(), block.Hash) != 0 || !pow.Validate() {
+		return ruleError(ErrHighHash, fmt.Sprintf("区块 %x 的工作量证明无效", block.Hash))
+	}
+
+	return nil
+}
+
+// 验证区块与前一区块的关系
+func (bc *Blockchain) checkBlockContext(tx *bolt.Tx, block *Block, prevBlock *Block) error {
+	// 区块高度必须比前一区块高1
+	if block.Height != prevBlock.Height + 1 {
+		return ruleError(ErrBadHeight, fmt.Sprintf("区块 %x 的高度 %d 与前一区块的高度 %d 不连续", block.Hash, block.Height, prevBlock.Height))
+	}
+
+	// 通过共识引擎验证依赖前面区块的字段(难度值或签名节点)
+	err := bc.engine.VerifyContext(tx, prevBlock, block)
+	if err != nil {
+		return err
+	}
+
+	// 区块必须与检查点一致, 且不能在已经经过的检查点之前分叉
+	err = bc.checkBlockCheckpoints(tx, block)
+	if err != nil {
+		return err
+	}
+
+	// 通过软分叉部署激活的规则
+	state, err := bc.deploymentState(tx, prevBlock, chaincfg.DeploymentHeightInCoinbase)
+	if err != nil {
+		return err
+	}
+
+	if state == ThresholdActive {
+		err = checkCoinbaseHeight(block)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 区块的时间戳必须大于前11个区块时间戳的中位数
+	medianTime, err := calcPastMedianTime(tx, prevBlock)
+	if err != nil {
+		return err
+	}
+
+	if int64(block.Time) <= medianTime {
+		return ruleError(ErrTimeTooOld, fmt.Sprintf("区块 %x 的时间戳 %d 不大于前%d个区块时间戳的中位数 %d", block.Hash, block.Time, medianTimeBlocks, medianTime))
+	}
+
+	return nil
+}
+
+/*
+	summary：根据UTXO桶验证区块中的交易, UTXO桶必须对应区块的前一区块的状态
+	验证内容: 输入引用的输出存在且未花费、coinbase输出已成熟、区块内没有双花、输入签名有效、输入总金额及手续费之和不超出金额范围、输出不大于输入、coinbase金额不超过奖励与手续费之和
+	checkSignatures: 是否验证输入签名, 假定有效区块及其祖先区块不需要验证
+	return: 区块内全部交易的手续费之和
+*/
+func (bc *Blockchain) checkBlockTransactions(tx *bolt.Tx, block *Block, checkSignatures bool) (int, error) {
+	utxo := tx.Bucket([]byte(utxoBucket))
+
+	// 区块内已经花费的输出 key: 交易ID:输出序号
+	spent := make(map[string]bool)
+
+	// 区块内前面的交易, 后面的交易可以花费前面交易的输出 key: 交易ID
+	blockTXs := make(map[string]*transaction.Transaction)
+
+	// 区块内全部交易的手续费
+	totalFees := 0
+
+	// 区块内全部交易的签名操作数量, 包括花费支付到脚本Hash的输出时赎回脚本中的签名操作
+	sigOps := countBlockSigOps(block)
+
+	for _, blockTx := range block.Transactions {
+		txID := hex.EncodeToString(blockTx.ID)
+
+		if blockTx.IsCoinBase() {
+			blockTXs[txID] = blockTx
+			continue
+		}
+
+		// 存放当前交易的输入所引用的输出, 用于验证签名 key: 交易ID, value: 只包含被引用输出的交易
+		prevTXs := make(map[string]transaction.Transaction)
+
+		for _, vin := range blockTx.Vin {
+			outpoint := fmt.Sprintf("%x:%d", vin.TXid, vin.VoutIndex)
+
+			// 同一个输出在区块内不能被花费两次
+			if spent[outpoint] {
+				return 0, ruleError(ErrDoubleSpend, fmt.Sprintf("交易 %x 的输入 %s 在区块中被重复花费", blockTx.ID, outpoint))
+			}
+			spent[outpoint] = true
+
+			// 查找输入引用的输出: 先查找区块内前面的交易, 再查找UTXO桶
+			prevOuts, ok := lookupOutputs(utxo, blockTXs, block.Height, vin.TXid)
+			prevOut, exists := prevOuts.Outputs[vin.VoutIndex]
+			if !ok || !exists {
+				return 0, ruleError(ErrMissingTxOut, fmt.Sprintf("交易 %x 的输入 %s 引用的输出不存在或已花费", blockTx.ID, outpoint))
+			}
+
+			// coinbase交易的输出未成熟前不能被花费
+			if !prevOuts.IsMature(block.Height, bc.params.CoinbaseMaturity) {
+				return 0, ruleError(ErrImmatureSpend, fmt.Sprintf("交易 %x 的输入 %s 花费了高度为 %d 的未成熟coinbase输出",
+					blockTx.ID, outpoint, prevOuts.Height))
+			}
+
+			// 构建只包含被引用输出的前一交易, 用于签名验证
+			addPrevOutput(prevTXs, vin, prevOut)
+		}
+
+		// 赎回脚本只有在查找到被花费的输出后才能确定, 区块的签名操作数量在此处计算完整
+		sigOps += blockTx.P2SHSigOpCount(prevTXs)
+		if sigOps > MaxBlockSigOps {
+			return 0, ruleError(ErrTooManySigOps, fmt.Sprintf("区块 %x 的签名操作数量 %d 超过限制 %d", block.Hash, sigOps, MaxBlockSigOps))
+		}
+
+		// 验证交易所有输入的签名
+		if checkSignatures && !blockTx.Verify(prevTXs) {
+			return 0, ruleError(ErrBadSignature, fmt.Sprintf("交易 %x 的签名无效", blockTx.ID))
+		}
+
+		// 交易手续费 = 输入总金额 - 输出总金额, 手续费不能为负数
+		fee, err := CheckTransactionInputs(bc.params, blockTx, prevTXs)
+		if err != nil {
+			return 0, err
+		}
+
+		// 手续费之和同样不能超出金额范围, 以免累加溢出
+		if fee > MaxMoney(bc.params) - totalFees {
+			return 0, ruleError(ErrBadFees, fmt.Sprintf("区块 %x 的交易手续费之和超过金额上限 %d", block.Hash, MaxMoney(bc.params)))
+		}
+
+		totalFees += fee
+		blockTXs[txID] = blockTx
+	}
+
+	// coinbase交易的金额不能超过区块奖励与手续费之和, coinbase的输出总金额已由区块本身的验证限制在金额范围内
+	coinbaseValue := 0
+	for _, out := range block.Transactions[0].Vout {
+		coinbaseValue += out.Value
+	}
+
+	maxCoinbaseValue := transaction.GetBlockSubsidy(bc.params, block.Height) + totalFees
+	if coinbaseValue > maxCoinbaseValue {
+		return 0, ruleError(ErrBadCoinbaseValue, fmt.Sprintf("区块 %x 的coinbase金额 %d 大于区块奖励与手续费之和 %d",
+			block.Hash, coinbaseValue, maxCoinbaseValue))
+	}
+
+	return totalFees, nil
+}
+
+// 交易金额的上限, 即网络的累计发行总量上限, 不设上限时为int能表示的最大值
+func MaxMoney(params *chaincfg.Params) int {
+	if params.MaxSupply > 0 {
+		return params.MaxSupply
+	}
+
+	return int(^uint(0) >> 1)
+}
+
+// 验证交易的每个输出金额在 0~金额上限 范围内, 且输出总金额累加时不溢出、不超过金额上限
+func CheckTransactionSanity(params *chaincfg.Params, tx *transaction.Transaction) error {
+	maxMoney := MaxMoney(params)
+
+	totalOut := 0
+	for _, out := range tx.Vout {
+		if out.Value < 0 {
+			return ruleError(ErrBadTxOutValue, fmt.Sprintf("交易 %x 的输出金额 %d 为负数", tx.ID, out.Value))
+		}
+
+		if out.Value > maxMoney {
+			return ruleError(ErrBadTxOutValue, fmt.Sprintf("交易 %x 的输出金额 %d 超过金额上限 %d", tx.ID, out.Value, maxMoney))
+		}
+
+		if out.Value > maxMoney - totalOut {
+			return ruleError(ErrBadTxOutValue, fmt.Sprintf("交易 %x 的输出总金额超过金额上限 %d", tx.ID, maxMoney))
+		}
+		totalOut += out.Value
+	}
+
+	return nil
+}
+
+/*
+	summary：根据交易输入引用的输出计算交易手续费, 输入总金额累加时不能溢出或超过金额上限, 输出总金额不能大于输入总金额
+	交易的输出须已通过CheckTransactionSanity的验证
+	prevTXs: 只包含被引用输出的前一交易 key: 交易ID
+	return: 交易手续费, 即输入总金额 - 输出总金额
+*/
+func CheckTransactionInputs(params *chaincfg.Params, tx *transaction.Transaction, prevTXs map[string]transaction.Transaction) (int, error) {
+	maxMoney := MaxMoney(params)
+
+	totalIn := 0
+	for _, vin := range tx.Vin {
+		prevTx, ok := prevTXs[hex.EncodeToString(vin.TXid)]
+		if !ok || vin.VoutIndex < 0 || vin.VoutIndex >= len(prevTx.Vout) {
+			return 0, ruleError(ErrMissingTxOut, fmt.Sprintf("交易 %x 的输入 %x:%d 引用的输出不存在", tx.ID, vin.TXid, vin.VoutIndex))
+		}
+
+		value := prevTx.Vout[vin.VoutIndex].Value
+		if value < 0 || value > maxMoney - totalIn {
+			return 0, ruleError(ErrBadTxInValue, fmt.Sprintf("交易 %x 的输入总金额超过金额上限 %d", tx.ID, maxMoney))
+		}
+		totalIn += value
+	}
+
+	totalOut := 0
+	for _, out := range tx.Vout {
+		totalOut += out.Value
+	}
+
+	fee := totalIn - totalOut
+	if fee < 0 {
+		return 0, ruleError(ErrSpendTooHigh, fmt.Sprintf("交易 %x 的输出总金额 %d 大于输入总金额 %d, 手续费为负数", tx.ID, totalOut, totalIn))
+	}
+
+	return fee, nil
+}
+
+// 将输入引用的输出加入只包含被引用输出的前一交易集合 key: 交易ID
+func addPrevOutput(prevTXs map[string]transaction.Transaction, vin transaction.TXInput, prevOut transaction.TXOutput) {
+	vinID := hex.EncodeToString(vin.TXid)
+	prevTX := prevTXs[vinID]
+	prevTX.ID = vin.TXid
+	for len(prevTX.Vout) <= vin.VoutIndex {
+		prevTX.Vout = append(prevTX.Vout, transaction.TXOutput{})
+	}
+	prevTX.Vout[vin.VoutIndex] = prevOut
+	prevTXs[vinID] = prevTX
+}
+
+/*
+	summary：查找交易的未花费输出集合, 先查找区块内前面的交易, 再查找UTXO桶
+	height: 当前区块的高度, 区块内的交易的输出位于该高度
+*/
+func lookupOutputs(utxo *bolt.Bucket, blockTXs map[string]*transaction.Transaction, height int32, txID []byte) (transaction.TXOutputs, bool) {
+	if prevTx, ok := blockTXs[hex.EncodeToString(txID)]; ok {
+		outs := transaction.NewTXOutputs()
+		outs.Height = height
+		outs.IsCoinbase = prevTx.IsCoinBase()
+		for outIdx, out := range prevTx.Vout {
+			outs.Outputs[outIdx] = out
+		}
+
+		return outs, true
+	}
+
+	outsBytes := utxo.Get(txID)
+	if outsBytes == nil {
+		return transaction.TXOutputs{}, false
+	}
+
+	return transaction.DeserializeOutputs(outsBytes), true
+}
@@ -0,0 +1,246 @@
+/*
+  软分叉部署（BIP9）：矿工通过区块版本号中的位表决，每个表决周期结束时统计表决数量，达到阈值后锁定，下一个周期激活新规则
+*/
+package blockchain
+
+import (
+	"bytes"
+	"core/chaincfg"
+	"encoding/hex"
+	"fmt"
+	"github.com/boltdb"
+	"utils"
+)
+
+const (
+	// 使用版本号位表决的区块, 版本号的最高3位固定为001
+	vbTopBits = 0x20000000
+
+	// 版本号最高3位的掩码
+	vbTopMask = 0xe0000000
+)
+
+// 软分叉部署的状态, 同一表决周期内的区块状态相同
+type ThresholdState int
+
+const (
+	// 尚未开始表决
+	ThresholdDefined ThresholdState = iota
+
+	// 正在表决
+	ThresholdStarted
+
+	// 已锁定, 下一个表决周期激活
+	ThresholdLockedIn
+
+	// 已激活, 新规则生效
+	ThresholdActive
+
+	// 超时未锁定, 部署失败
+	ThresholdFailed
+)
+
+// 部署状态对应的名称
+var thresholdStateStrings = map[ThresholdState]string{
+	ThresholdDefined:  "DEFINED",
+	ThresholdStarted:  "STARTED",
+	ThresholdLockedIn: "LOCKED_IN",
+	ThresholdActive:   "ACTIVE",
+	ThresholdFailed:   "FAILED",
+}
+
+// 打印部署状态
+func (s ThresholdState) String() string {
+	if name := thresholdStateStrings[s]; name != "" {
+		return name
+	}
+
+	return fmt.Sprintf("Unknown ThresholdState (%d)", int(s))
+}
+
+// 判断区块版本号是否对指定位表决支持
+func signalsBit(version int32, bit uint8) bool {
+	return uint32(version) & vbTopMask == vbTopBits && uint32(version) & (uint32(1) << bit) != 0
+}
+
+// 获取区块的祖先区块中指定高度的区块, 高度不低于该区块时返回该区块本身
+func ancestorAt(tx *bolt.Tx, block *Block, height int32) (*Block, error) {
+	current := block
+	for current.Height > height {
+		prevBlock, err := getBlock(tx, current.PrevBlockHash)
+		if err != nil {
+			return nil, err
+		}
+		current = prevBlock
+	}
+
+	return current, nil
+}
+
+/*
+	summary：统计以指定区块结尾的表决周期内表决支持的区块数量
+	last: 表决周期的最后一个区块
+*/
+func countSignals(tx *bolt.Tx, last *Block, window int32, bit uint8) (int32, error) {
+	var count int32
+	current := last
+	for i := int32(0); i < window; i++ {
+		if signalsBit(current.Version, bit) {
+			count++
+		}
+
+		// 创世区块没有前一区块
+		if len(current.PrevBlockHash) == 0 {
+			break
+		}
+
+		prevBlock, err := getBlock(tx, current.PrevBlockHash)
+		if err != nil {
+			return 0, err
+		}
+		current = prevBlock
+	}
+
+	return count, nil
+}
+
+/*
+	summary：计算前一区块之后的区块所处的软分叉部署状态
+	状态在每个表决周期的最后一个区块之后更新, 已计算的状态按周期最后一个区块的Hash缓存, 分叉链上的区块使用各自的祖先区块计算
+	prevBlock: 下一个区块的前一区块
+	id: 部署的编号
+*/
+func (bc *Blockchain) deploymentState(tx *bolt.Tx, prevBlock *Block, id int) (ThresholdState, error) {
+	window := bc.params.MinerConfirmationWindow
+	deployment := bc.params.Deployments[id]
+	if window <= 0 {
+		return ThresholdDefined, nil
+	}
+
+	// 前一个表决周期的最后一个区块, 下一个区块位于第一个表决周期时不存在, 状态为DEFINED
+	height := prevBlock.Height + 1
+	boundaryHeight := height - height % window - 1
+	if boundaryHeight < 0 {
+		return ThresholdDefined, nil
+	}
+
+	boundary, err := ancestorAt(tx, prevBlock, boundaryHeight)
+	if err != nil {
+		return ThresholdDefined, err
+	}
+
+	bc.versionBitsLock.Lock()
+	defer bc.versionBitsLock.Unlock()
+
+	cache := bc.versionBitsCache[id]
+
+	// 往前找到状态已知的表决周期: 已缓存的周期, 开始表决之前的周期或第一个表决周期
+	state := ThresholdDefined
+	var pending []*Block
+	for boundary != nil {
+		if cached, ok := cache[hex.EncodeToString(boundary.Hash)]; ok {
+			state = cached
+			break
+		}
+
+		// 开始表决之前的周期, 状态均为DEFINED
+		if boundary.Height + 1 < deployment.StartHeight {
+			break
+		}
+
+		pending = append(pending, boundary)
+		if boundary.Height < window {
+			break
+		}
+
+		boundary, err = ancestorAt(tx, boundary, boundary.Height - window)
+		if err != nil {
+			return ThresholdDefined, err
+		}
+	}
+
+	// 从最早的表决周期开始依次计算状态
+	for i := len(pending) - 1; i >= 0; i-- {
+		last := pending[i]
+		nextHeight := last.Height + 1
+
+		switch state {
+		case ThresholdDefined:
+			if nextHeight >= deployment.TimeoutHeight {
+				state = ThresholdFailed
+			} else if nextHeight >= deployment.StartHeight {
+				state = ThresholdStarted
+			}
+		case ThresholdStarted:
+			if nextHeight >= deployment.TimeoutHeight {
+				state = ThresholdFailed
+				break
+			}
+
+			// 表决支持的区块数量达到阈值则锁定
+			count, err := countSignals(tx, last, window, deployment.BitNumber)
+			if err != nil {
+				return ThresholdDefined, err
+			}
+
+			if count >= deployment.Threshold {
+				state = ThresholdLockedIn
+			}
+		case ThresholdLockedIn:
+			// 锁定后的下一个表决周期激活
+			state = ThresholdActive
+		}
+
+		cache[hex.EncodeToString(last.Hash)] = state
+	}
+
+	return state, nil
+}
+
+// 获取当前最新区块之后的区块所处的软分叉部署状态
+func (bc *Blockchain) DeploymentState(id int) (ThresholdState, error) {
+	var state ThresholdState
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		lastBlock, err := getBlock(tx, bc.GetCurrentHash())
+		if err != nil {
+			return err
+		}
+
+		state, err = bc.deploymentState(tx, lastBlock, id)
+		return err
+	})
+
+	return state, err
+}
+
+// 计算下一个区块的版本号, 对处于表决或锁定状态的软分叉部署表决支持
+func (bc *Blockchain) calcNextBlockVersion(tx *bolt.Tx, prevBlock *Block) (int32, error) {
+	version := uint32(vbTopBits)
+	for id := 0; id < chaincfg.DefinedDeployments; id++ {
+		state, err := bc.deploymentState(tx, prevBlock, id)
+		if err != nil {
+			return 0, err
+		}
+
+		if state == ThresholdStarted || state == ThresholdLockedIn {
+			version |= uint32(1) << bc.params.Deployments[id].BitNumber
+		}
+	}
+
+	return int32(version), nil
+}
+
+// coinbase交易数据开头的区块高度, 4个字节小端序
+func coinbaseHeightPrefix(height int32) []byte {
+	return utils.IntToHex(height, true)
+}
+
+// 软分叉激活后, coinbase交易的数据必须以区块高度开头, 保证不同区块的coinbase交易ID不同
+func checkCoinbaseHeight(block *Block) error {
+	coinbaseData := block.Transactions[0].Vin[0].ScriptSig
+	if !bytes.HasPrefix(coinbaseData, coinbaseHeightPrefix(block.Height)) {
+		return ruleError(ErrBadCoinbaseHeight, fmt.Sprintf("区块 %x 的coinbase交易数据未以区块高度 %d 开头", block.Hash, block.Height))
+	}
+
+	return nil
+}
@@ -0,0 +1,368 @@
+/*
+  网络参数，定义主网、测试网络、回归测试网络等网络的创世区块、地址前缀、节点网络及共识参数
+*/
+package chaincfg
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"utils"
+)
+
+// 共识引擎类型
+const (
+	ConsensusPoW = "pow" // 工作量证明
+	ConsensusPoA = "poa" // 权威证明
+)
+
+// 工作量证明哈希算法
+const (
+	PowSHA256d  = "sha256d"  // 双重SHA256
+	PowScrypt   = "scrypt"   // scrypt, 内存困难, 适合CPU挖矿
+	PowArgon2id = "argon2id" // Argon2id, 内存困难, 适合CPU挖矿
+)
+
+// scrypt算法参数
+type ScryptParams struct {
+	N int // CPU及内存开销, 必须是大于1的2的幂
+	R int // 块大小
+	P int // 并行度
+}
+
+// Argon2id算法参数
+type Argon2Params struct {
+	Time    uint32 // 迭代次数
+	Memory  uint32 // 内存开销(KiB)
+	Threads uint8  // 并行度
+}
+
+// 软分叉部署的编号, 即部署在Params.Deployments中的序号
+const (
+	// 要求coinbase交易的数据以区块高度开头
+	DeploymentHeightInCoinbase = iota
+
+	// 软分叉部署的数量, 新的部署需加在此之前
+	DefinedDeployments
+)
+
+// 通过区块版本号位(versionbits)表决激活的软分叉部署
+type ConsensusDeployment struct {
+	Name          string // 部署名称
+	BitNumber     uint8  // 区块版本号中用于表决的位, 取值0~28
+	StartHeight   int32  // 从该高度开始的表决周期开始表决
+	TimeoutHeight int32  // 到该高度仍未锁定则部署失败
+	Threshold     int32  // 一个表决周期内至少需要多少个区块表决支持才能锁定
+}
+
+// 检查点: 指定高度的区块必须是指定Hash的区块
+type Checkpoint struct {
+	Height int32  // 区块高度
+	Hash   string // 区块Hash的16进制字符串
+}
+
+// 网络参数, 不同网络的区块链、地址及节点互不相通
+type Params struct {
+	Name            string   // 网络名称
+	Net             uint32   // 网络魔数, 节点之间的每条消息都以魔数开头, 用于区分不同网络的消息
+	ProtocolVersion int32    // 节点协议版本
+	DefaultPort     string   // 节点默认监听的端口
+	Seeds           []string // 种子节点地址, 第一个种子节点为中心节点
+	DataDir         string   // 区块链数据库及钱包文件所在的目录, 为空表示当前目录
+
+	PubKeyHashAddrID byte // 公钥Hash地址的版本号
+	ScriptHashAddrID byte // 脚本Hash地址(多重签名地址)的版本号, 不能与任何网络的公钥Hash地址版本号相同
+
+	GenesisAddress string // 创世区块奖励的接收地址, 版本号必须与网络的公钥Hash地址版本号一致
+	GenesisData    string // 创世区块coinbase交易的数据
+	GenesisTime    int32  // 创世区块的时间戳, 固定时间戳保证同一网络的创世区块相同
+
+	PowAlgorithm     string       // 工作量证明哈希算法
+	PowScrypt        ScryptParams // PowAlgorithm为scrypt时的算法参数
+	PowArgon2        Argon2Params // PowAlgorithm为argon2id时的算法参数
+	PowLimitBits     int32        // 最低难度（最大目标值）的压缩格式
+	RetargetInterval int32 // 难度调整周期（每隔多少个区块调整一次难度），小于等于0表示不调整
+	TargetBlockTime  int32 // 期望的出块时间（秒）
+	MaxAdjustFactor  int64 // 单次难度调整的最大倍数
+
+	InitialSubsidy   int   // 初始区块奖励
+	HalvingInterval  int32 // 奖励减半周期（每隔多少个区块减半一次），小于等于0表示不减半
+	MaxSupply        int   // 累计发行总量上限，小于等于0表示不设上限
+	CoinbaseMaturity int32 // coinbase交易的输出需要经过的确认数
+
+	MinerConfirmationWindow int32                                   // 软分叉表决周期的区块数量, 每个周期结束时更新部署状态
+	Deployments             [DefinedDeployments]ConsensusDeployment // 软分叉部署
+
+	Checkpoints []Checkpoint // 检查点, 按高度从低到高排列
+	AssumeValid string       // 假定有效区块Hash的16进制字符串, 该区块的祖先区块不验证交易签名, 为空表示不启用
+
+	Consensus      string   // 共识引擎类型
+	PoAAuthorities []string // 权威证明共识下权威节点公钥的16进制字符串
+}
+
+// 主网参数
+var MainNetParams = Params{
+	Name:            "mainnet",
+	Net:             0xd9b4bef9,
+	ProtocolVersion: 0x00,
+	DefaultPort:     "3000",
+	Seeds:           []string{"localhost:3000"},
+	DataDir:         "",
+
+	PubKeyHashAddrID: 0x00,
+	ScriptHashAddrID: 0x05,
+
+	GenesisAddress: "1FdsuGae3QNWcJLg2yKNQ1vZkZ5Cdg3KUm",
+	GenesisData:    "这是创世区块的内容",
+	GenesisTime:    1609459200,
+
+	PowAlgorithm:     PowSHA256d,
+	// 对应目标值 1 << 240, 即目标值前导0的位数为16
+	PowLimitBits:     0x1f010000,
+	RetargetInterval: 20,
+	TargetBlockTime:  10,
+	MaxAdjustFactor:  4,
+
+	InitialSubsidy:   100,
+	HalvingInterval:  1000,
+	MaxSupply:        200000,
+	CoinbaseMaturity: 10,
+
+	// 主网尚未开始表决
+	MinerConfirmationWindow: 20,
+	Deployments: [DefinedDeployments]ConsensusDeployment{
+		DeploymentHeightInCoinbase: {
+			Name:          "heightincoinbase",
+			BitNumber:     1,
+			StartHeight:   math.MaxInt32,
+			TimeoutHeight: math.MaxInt32,
+			Threshold:     19,
+		},
+	},
+
+	Checkpoints: []Checkpoint{},
+	AssumeValid: "",
+
+	Consensus: ConsensusPoW,
+}
+
+// 测试网络参数: 共识规则与主网相同, 使用不同的魔数、端口、地址版本号及数据目录
+var TestNetParams = Params{
+	Name:            "testnet",
+	Net:             0x0709110b,
+	ProtocolVersion: 0x00,
+	DefaultPort:     "13000",
+	Seeds:           []string{"localhost:13000"},
+	DataDir:         "testnet",
+
+	PubKeyHashAddrID: 0x41,
+	ScriptHashAddrID: 0x3a,
+
+	GenesisAddress: "TQc5uKxNC8VTmUQJdEy5vAchfLpWrxGa85",
+	GenesisData:    "这是测试网络创世区块的内容",
+	GenesisTime:    1609459200,
+
+	PowAlgorithm:     PowSHA256d,
+	PowLimitBits:     0x1f010000,
+	RetargetInterval: 20,
+	TargetBlockTime:  10,
+	MaxAdjustFactor:  4,
+
+	InitialSubsidy:   100,
+	HalvingInterval:  1000,
+	MaxSupply:        200000,
+	CoinbaseMaturity: 10,
+
+	// 测试网络先于主网表决激活新规则, 表决周期与难度调整周期相同, 需要75%的区块表决支持
+	MinerConfirmationWindow: 20,
+	Deployments: [DefinedDeployments]ConsensusDeployment{
+		DeploymentHeightInCoinbase: {
+			Name:          "heightincoinbase",
+			BitNumber:     1,
+			StartHeight:   2000,
+			TimeoutHeight: 22000,
+			Threshold:     15,
+		},
+	},
+
+	Checkpoints: []Checkpoint{},
+	AssumeValid: "",
+
+	Consensus: ConsensusPoW,
+}
+
+// 回归测试网络参数: 目标值接近最大值且不调整难度, 几乎每次hash计算都能挖矿成功, 用于本地快速生成区块
+var RegtestParams = Params{
+	Name:            "regtest",
+	Net:             0xdab5bffa,
+	ProtocolVersion: 0x00,
+	DefaultPort:     "18444",
+	Seeds:           []string{"localhost:18444"},
+	DataDir:         "regtest",
+
+	PubKeyHashAddrID: 0x6f,
+	ScriptHashAddrID: 0xc4,
+
+	GenesisAddress: "mv9qCKfcrRomPQpHkYHkDw8tcYfuZh8eav",
+	GenesisData:    "这是回归测试网络创世区块的内容",
+	GenesisTime:    1609459200,
+
+	PowAlgorithm:     PowSHA256d,
+	PowLimitBits:     0x207fffff,
+	RetargetInterval: 0,
+	TargetBlockTime:  10,
+	MaxAdjustFactor:  4,
+
+	InitialSubsidy:   100,
+	HalvingInterval:  1000,
+	MaxSupply:        200000,
+	CoinbaseMaturity: 10,
+
+	// 从创世区块开始表决且不会超时, 用于本地测试软分叉的激活过程
+	MinerConfirmationWindow: 10,
+	Deployments: [DefinedDeployments]ConsensusDeployment{
+		DeploymentHeightInCoinbase: {
+			Name:          "heightincoinbase",
+			BitNumber:     1,
+			StartHeight:   0,
+			TimeoutHeight: math.MaxInt32,
+			Threshold:     8,
+		},
+	},
+
+	Checkpoints: []Checkpoint{},
+	AssumeValid: "",
+
+	Consensus: ConsensusPoW,
+}
+
+// 社区网络参数: 使用内存困难的scrypt算法挖矿, 普通CPU即可参与, 最低难度低于主网
+var CommunityNetParams = Params{
+	Name:            "community",
+	Net:             0xc5d0a3e1,
+	ProtocolVersion: 0x00,
+	DefaultPort:     "23000",
+	Seeds:           []string{"localhost:23000"},
+	DataDir:         "community",
+
+	PubKeyHashAddrID: 0x1c,
+	ScriptHashAddrID: 0x32,
+
+	GenesisAddress: "CX6mUJvhvTM3WSF6iieHyXYbNgHcXXrinX",
+	GenesisData:    "这是社区网络创世区块的内容",
+	GenesisTime:    1609459200,
+
+	// scrypt参数与莱特币相同, 每次hash约使用128KB内存; 对应目标值 0x0fffff << 224, 即目标值前导0的位数为12
+	PowAlgorithm:     PowScrypt,
+	PowScrypt:        ScryptParams{N: 1024, R: 1, P: 1},
+	PowLimitBits:     0x1f0fffff,
+	RetargetInterval: 20,
+	TargetBlockTime:  10,
+	MaxAdjustFactor:  4,
+
+	InitialSubsidy:   100,
+	HalvingInterval:  1000,
+	MaxSupply:        200000,
+	CoinbaseMaturity: 10,
+
+	MinerConfirmationWindow: 20,
+	Deployments: [DefinedDeployments]ConsensusDeployment{
+		DeploymentHeightInCoinbase: {
+			Name:          "heightincoinbase",
+			BitNumber:     1,
+			StartHeight:   0,
+			TimeoutHeight: math.MaxInt32,
+			Threshold:     15,
+		},
+	},
+
+	Checkpoints: []Checkpoint{},
+	AssumeValid: "",
+
+	Consensus: ConsensusPoW,
+}
+
+// 预发布网络参数: 使用权威证明共识, 由固定的权威节点签名区块, 不需要挖矿, 用于上线前的部署测试;
+// 权威节点的私钥由各权威节点的钱包保管, 节点通过环境变量POA_SIGNER指定签名使用的钱包地址
+var StagingNetParams = Params{
+	Name:            "staging",
+	Net:             0x5354a6e3,
+	ProtocolVersion: 0x00,
+	DefaultPort:     "33000",
+	Seeds:           []string{"localhost:33000"},
+	DataDir:         "staging",
+
+	PubKeyHashAddrID: 0x3f,
+	ScriptHashAddrID: 0x7d,
+
+	GenesisAddress: "ShtQyKk4aqgg3P7QNk7RJiWQkaJLcbjM7o",
+	GenesisData:    "这是预发布网络创世区块的内容",
+	GenesisTime:    1609459200,
+
+	// 权威证明下轮到签名的区块使用最低难度一半的目标值, 未轮到的区块使用最低难度, 即轮到签名的区块工作量为两倍
+	PowAlgorithm:     PowSHA256d,
+	PowLimitBits:     0x207fffff,
+	RetargetInterval: 0,
+	TargetBlockTime:  10,
+	MaxAdjustFactor:  4,
+
+	InitialSubsidy:   100,
+	HalvingInterval:  1000,
+	MaxSupply:        200000,
+	CoinbaseMaturity: 10,
+
+	MinerConfirmationWindow: 20,
+	Deployments: [DefinedDeployments]ConsensusDeployment{
+		DeploymentHeightInCoinbase: {
+			Name:          "heightincoinbase",
+			BitNumber:     1,
+			StartHeight:   0,
+			TimeoutHeight: math.MaxInt32,
+			Threshold:     15,
+		},
+	},
+
+	Checkpoints: []Checkpoint{},
+	AssumeValid: "",
+
+	Consensus: ConsensusPoA,
+	PoAAuthorities: []string{
+		"d4b3ed45dd3779ab9b54ed0cab0eea6f9ebc043499341b9e0d4385090377f98d8d0123469c30c68c6a699f01f7eb58e2693aabe5d0ed12e4798968b7048d8b7c",
+		"f5256803946a814472262739066a0ccc6aa29700a196546b9bb6ecb070f2fa4dbdb14be22be6c808d3ff2f7de64cdaca3588e15df510f9f6aa4a5fbbc35d7626",
+		"19c25487b70f409db0b4c9373f917c7d004652df63ca78b04847dd18c8559e7eee07bb6d49929f87b83215998d8ffd5427a907b434cdd6f62f175f6fdd9e06c6",
+	},
+}
+
+// 全部网络
+var allParams = []*Params{&MainNetParams, &TestNetParams, &RegtestParams, &CommunityNetParams, &StagingNetParams}
+
+// 根据网络名称获取网络参数
+func ParamsByName(name string) (*Params, error) {
+	var names []string
+	for _, params := range allParams {
+		if params.Name == name {
+			return params, nil
+		}
+		names = append(names, params.Name)
+	}
+
+	return nil, fmt.Errorf("未知的网络: %s, 可选: %s", name, strings.Join(names, ", "))
+}
+
+// 判断地址版本号是否为某个网络的脚本Hash地址版本号, 用于在不知道网络时区分地址类型
+func IsScriptHashAddrID(id byte) bool {
+	for _, params := range allParams {
+		if params.ScriptHashAddrID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// 获取最低难度对应的目标值
+func (params *Params) PowLimit() *big.Int {
+	limit, _, _ := utils.CompactToBig(uint32(params.PowLimitBits))
+	return limit
+}
@@ -0,0 +1,81 @@
+package mempool
+
+import "fmt"
+
+// 交易池拒绝交易的错误码
+type ErrorCode int
+
+const (
+	// coinbase交易只能出现在区块中
+	ErrCoinbase ErrorCode = iota
+
+	// 交易的ID与交易内容不一致
+	ErrBadTxID
+
+	// 交易没有输入或输出, 或输出金额为负数
+	ErrInvalidTx
+
+	// 交易序列化后的大小超过区块的最大大小
+	ErrTxTooBig
+
+	// 交易已在交易池或区块链中
+	ErrDuplicate
+
+	// 交易的输入与交易池中其他交易的输入花费同一个输出
+	ErrConflict
+
+	// 交易的输入引用的输出不存在或已花费
+	ErrMissingInputs
+
+	// 交易的输入花费了未成熟的coinbase输出
+	ErrImmatureSpend
+
+	// 交易的签名无效
+	ErrBadSignature
+
+	// 交易的输出总金额大于输入总金额, 即手续费为负数
+	ErrNegativeFee
+
+	// 交易池已满, 交易的手续费率过低被淘汰
+	ErrPoolFull
+)
+
+// 错误码对应的字符串
+var errorCodeStrings = map[ErrorCode]string{
+	ErrCoinbase:      "ErrCoinbase",
+	ErrBadTxID:       "ErrBadTxID",
+	ErrInvalidTx:     "ErrInvalidTx",
+	ErrTxTooBig:      "ErrTxTooBig",
+	ErrDuplicate:     "ErrDuplicate",
+	ErrConflict:      "ErrConflict",
+	ErrMissingInputs: "ErrMissingInputs",
+	ErrImmatureSpend: "ErrImmatureSpend",
+	ErrBadSignature:  "ErrBadSignature",
+	ErrNegativeFee:   "ErrNegativeFee",
+	ErrPoolFull:      "ErrPoolFull",
+}
+
+// 打印错误码
+func (e ErrorCode) String() string {
+	if s := errorCodeStrings[e]; s != "" {
+		return s
+	}
+
+	return fmt.Sprintf("Unknown ErrorCode (%d)", int(e))
+}
+
+// 交易池拒绝交易的错误, 通过错误码区分具体的原因
+type TxRuleError struct {
+	ErrorCode   ErrorCode // 错误码
+	Description string    // 错误描述
+}
+
+// 实现error接口
+func (e TxRuleError) Error() string {
+	return e.Description
+}
+
+// 构建交易池拒绝交易的错误
+func txRuleError(code ErrorCode, desc string) TxRuleError {
+	return TxRuleError{ErrorCode: code, Description: desc}
+}
@@ -0,0 +1,534 @@
+/*
+  交易池，存放已验证但尚未打包进区块的交易，记录交易之间的依赖关系，按大小及时间淘汰交易，并按手续费率为区块选择交易
+*/
+package mempool
+
+import (
+	"bytes"
+	"core/blockchain"
+	"core/transaction"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 交易池中交易序列化后的默认最大总字节数
+const DefaultMaxPoolSize = 10 * blockchain.MaxBlockSize
+
+// 交易在交易池中的默认最长保存时间, 超过时间仍未被打包的交易被淘汰
+const DefaultMaxTxAge = 24 * time.Hour
+
+// 交易池配置
+type Config struct {
+	MaxPoolSize int              // 交易池中交易序列化后的最大总字节数
+	MaxTxAge    time.Duration    // 交易在交易池中的最长保存时间
+	Clock       blockchain.Clock // 时钟, 用于记录交易加入的时间及淘汰过期交易
+}
+
+// 默认的交易池配置
+func DefaultConfig() Config {
+	return Config{
+		MaxPoolSize: DefaultMaxPoolSize,
+		MaxTxAge:    DefaultMaxTxAge,
+		Clock:       blockchain.SystemClock,
+	}
+}
+
+// 交易池中的交易及其相关信息
+type TxDesc struct {
+	Tx       *transaction.Transaction
+	Added    time.Time // 加入交易池的时间
+	Height   int32     // 加入交易池时下一个区块的高度
+	Fee      int       // 手续费 = 输入总金额 - 输出总金额
+	Size     int       // 交易序列化后的字节数
+	FeePerKB int       // 手续费率: 每1000字节的手续费
+
+	seq uint64 // 加入交易池的序号, 父交易的序号总是小于子交易
+}
+
+// 交易池
+type TxPool struct {
+	lock   sync.RWMutex
+	bc     *blockchain.Blockchain
+	config Config
+
+	pool      map[string]*TxDesc // key: 交易ID的16进制字符串
+	outpoints map[string]*TxDesc // 被交易池中交易花费的输出 key: 交易ID:输出序号, value: 花费该输出的交易
+	totalSize int                // 交易池中交易序列化后的总字节数
+	nextSeq   uint64
+}
+
+// 根据区块链及配置构建交易池
+func NewTxPool(bc *blockchain.Blockchain, config Config) *TxPool {
+	return &TxPool{
+		bc:        bc,
+		config:    config,
+		pool:      make(map[string]*TxDesc),
+		outpoints: make(map[string]*TxDesc),
+	}
+}
+
+// 输出的key: 交易ID:输出序号
+func outpointKey(txID []byte, index int) string {
+	return fmt.Sprintf("%x:%d", txID, index)
+}
+
+// 计算手续费率: 每1000字节的手续费
+func calcFeePerKB(fee, size int) int {
+	if size <= 0 {
+		return 0
+	}
+
+	return fee * 1000 / size
+}
+
+/*
+	summary：验证交易并加入交易池, 输入可以引用主链的未花费输出, 也可以引用交易池中其他交易的输出
+	验证内容: 不是coinbase交易、交易ID有效、不重复、不与交易池中的交易冲突、输入引用的输出存在且已成熟、签名有效、手续费不为负数
+	return: 交易在交易池中的信息; 交易被拒绝时返回TxRuleError
+*/
+func (mp *TxPool) MaybeAcceptTransaction(tx *transaction.Transaction) (*TxDesc, error) {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	return mp.maybeAcceptTransaction(tx)
+}
+
+// 验证交易并加入交易池, 调用者需持有交易池的锁
+func (mp *TxPool) maybeAcceptTransaction(tx *transaction.Transaction) (*TxDesc, error) {
+	txID := hex.EncodeToString(tx.ID)
+
+	// 先淘汰过期的交易, 依赖过期交易的交易视为缺少输入
+	mp.expireOld()
+
+	if tx.IsCoinBase() {
+		return nil, txRuleError(ErrCoinbase, fmt.Sprintf("交易 %x 是coinbase交易, 只能出现在区块中", tx.ID))
+	}
+
+	if bytes.Compare(tx.Hash(), tx.ID) != 0 {
+		return nil, txRuleError(ErrBadTxID, fmt.Sprintf("交易 %x 的ID与交易内容不一致", tx.ID))
+	}
+
+	if len(tx.Vin) == 0 || len(tx.Vout) == 0 {
+		return nil, txRuleError(ErrInvalidTx, fmt.Sprintf("交易 %x 没有输入或输出", tx.ID))
+	}
+
+	// 输出金额的范围与区块验证使用相同的规则
+	err := blockchain.CheckTransactionSanity(mp.bc.Params(), tx)
+	if err != nil {
+		return nil, txRuleError(ErrInvalidTx, err.Error())
+	}
+
+	size := len(tx.Seialize())
+	if size > blockchain.MaxBlockSize {
+		return nil, txRuleError(ErrTxTooBig, fmt.Sprintf("交易 %x 的大小 %d 超过区块的最大大小 %d", tx.ID, size, blockchain.MaxBlockSize))
+	}
+
+	// 交易已在交易池中, 或者交易还有未花费的输出(已被打包进主链)
+	if _, ok := mp.pool[txID]; ok {
+		return nil, txRuleError(ErrDuplicate, fmt.Sprintf("交易 %x 已在交易池中", tx.ID))
+	}
+
+	utxoSet := blockchain.NewUTXOSet(mp.bc)
+	if utxoSet.HasUnspentOutputs(tx.ID) {
+		return nil, txRuleError(ErrDuplicate, fmt.Sprintf("交易 %x 已在区块链中", tx.ID))
+	}
+
+	// 同一个输出不能被交易本身或交易池中的其他交易重复花费
+	spent := make(map[string]bool)
+	for _, vin := range tx.Vin {
+		outpoint := outpointKey(vin.TXid, vin.VoutIndex)
+		if spent[outpoint] {
+			return nil, txRuleError(ErrConflict, fmt.Sprintf("交易 %x 的输入 %s 被重复花费", tx.ID, outpoint))
+		}
+		spent[outpoint] = true
+
+		if conflict, ok := mp.outpoints[outpoint]; ok {
+			return nil, txRuleError(ErrConflict, fmt.Sprintf("交易 %x 的输入 %s 已被交易池中的交易 %x 花费", tx.ID, outpoint, conflict.Tx.ID))
+		}
+	}
+
+	// 查找输入引用的输出: 先查找交易池中的父交易, 再查找主链的UTXO
+	utxoOutputs, height, err := utxoSet.FetchInputOutputs(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 存放当前交易的输入所引用的输出, 用于验证签名 key: 交易ID, value: 只包含被引用输出的交易
+	prevTXs := make(map[string]transaction.Transaction)
+
+	for _, vin := range tx.Vin {
+		vinID := hex.EncodeToString(vin.TXid)
+		outpoint := outpointKey(vin.TXid, vin.VoutIndex)
+
+		var prevOut transaction.TXOutput
+		if parent, ok := mp.pool[vinID]; ok {
+			if vin.VoutIndex < 0 || vin.VoutIndex >= len(parent.Tx.Vout) {
+				return nil, txRuleError(ErrMissingInputs, fmt.Sprintf("交易 %x 的输入 %s 引用的输出不存在", tx.ID, outpoint))
+			}
+			prevOut = parent.Tx.Vout[vin.VoutIndex]
+		} else {
+			outs, ok := utxoOutputs[vinID]
+			out, exists := outs.Outputs[vin.VoutIndex]
+			if !ok || !exists {
+				return nil, txRuleError(ErrMissingInputs, fmt.Sprintf("交易 %x 的输入 %s 引用的输出不存在或已花费", tx.ID, outpoint))
+			}
+
+			// coinbase交易的输出未成熟前不能被花费
+			if !outs.IsMature(height, mp.bc.Params().CoinbaseMaturity) {
+				return nil, txRuleError(ErrImmatureSpend, fmt.Sprintf("交易 %x 的输入 %s 花费了高度为 %d 的未成熟coinbase输出", tx.ID, outpoint, outs.Height))
+			}
+			prevOut = out
+		}
+
+		// 构建只包含被引用输出的前一交易, 用于签名验证
+		prevTX := prevTXs[vinID]
+		prevTX.ID = vin.TXid
+		for len(prevTX.Vout) <= vin.VoutIndex {
+			prevTX.Vout = append(prevTX.Vout, transaction.TXOutput{})
+		}
+		prevTX.Vout[vin.VoutIndex] = prevOut
+		prevTXs[vinID] = prevTX
+	}
+
+	if !tx.Verify(prevTXs) {
+		return nil, txRuleError(ErrBadSignature, fmt.Sprintf("交易 %x 的签名无效", tx.ID))
+	}
+
+	// 手续费 = 输入总金额 - 输出总金额, 不能为负数, 输入总金额与区块验证使用相同的规则
+	fee, err := blockchain.CheckTransactionInputs(mp.bc.Params(), tx, prevTXs)
+	if err != nil {
+		if ruleErr, ok := err.(blockchain.RuleError); ok && ruleErr.ErrorCode == blockchain.ErrSpendTooHigh {
+			return nil, txRuleError(ErrNegativeFee, err.Error())
+		}
+		return nil, txRuleError(ErrInvalidTx, err.Error())
+	}
+
+	desc := &TxDesc{
+		Tx:       tx,
+		Added:    mp.config.Clock.Now(),
+		Height:   height,
+		Fee:      fee,
+		Size:     size,
+		FeePerKB: calcFeePerKB(fee, size),
+		seq:      mp.nextSeq,
+	}
+	mp.nextSeq++
+	mp.addTransaction(desc)
+
+	// 交易池超过大小限制时淘汰手续费率最低的交易, 当前交易也可能被淘汰
+	mp.trimToSize()
+	if _, ok := mp.pool[txID]; !ok {
+		return nil, txRuleError(ErrPoolFull, fmt.Sprintf("交易池已满, 交易 %x 的手续费率 %d 过低", tx.ID, desc.FeePerKB))
+	}
+
+	return desc, nil
+}
+
+// 将交易加入交易池, 调用者需持有交易池的锁
+func (mp *TxPool) addTransaction(desc *TxDesc) {
+	mp.pool[hex.EncodeToString(desc.Tx.ID)] = desc
+	for _, vin := range desc.Tx.Vin {
+		mp.outpoints[outpointKey(vin.TXid, vin.VoutIndex)] = desc
+	}
+	mp.totalSize += desc.Size
+}
+
+/*
+	summary：从交易池中删除交易, 调用者需持有交易池的锁
+	removeRedeemers: 是否同时删除花费该交易输出的子交易(及其后代交易)
+*/
+func (mp *TxPool) removeTransaction(tx *transaction.Transaction, removeRedeemers bool) {
+	if removeRedeemers {
+		for _, child := range mp.children(tx) {
+			mp.removeTransaction(child.Tx, true)
+		}
+	}
+
+	txID := hex.EncodeToString(tx.ID)
+	desc, ok := mp.pool[txID]
+	if !ok {
+		return
+	}
+
+	for _, vin := range desc.Tx.Vin {
+		delete(mp.outpoints, outpointKey(vin.TXid, vin.VoutIndex))
+	}
+	delete(mp.pool, txID)
+	mp.totalSize -= desc.Size
+}
+
+// 从交易池中删除交易, removeRedeemers为true时同时删除依赖该交易的后代交易
+func (mp *TxPool) RemoveTransaction(tx *transaction.Transaction, removeRedeemers bool) {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	mp.removeTransaction(tx, removeRedeemers)
+}
+
+// 获取交易池中花费交易输出的子交易, 调用者需持有交易池的锁
+func (mp *TxPool) children(tx *transaction.Transaction) []*TxDesc {
+	var children []*TxDesc
+	for index := range tx.Vout {
+		if child, ok := mp.outpoints[outpointKey(tx.ID, index)]; ok {
+			children = append(children, child)
+		}
+	}
+
+	return children
+}
+
+// 获取交易池中交易所依赖的父交易, 调用者需持有交易池的锁
+func (mp *TxPool) parents(tx *transaction.Transaction) []*TxDesc {
+	var parents []*TxDesc
+	seen := make(map[string]bool)
+	for _, vin := range tx.Vin {
+		vinID := hex.EncodeToString(vin.TXid)
+		if parent, ok := mp.pool[vinID]; ok && !seen[vinID] {
+			seen[vinID] = true
+			parents = append(parents, parent)
+		}
+	}
+
+	return parents
+}
+
+// 获取交易池中依赖指定交易的子交易
+func (mp *TxPool) Children(tx *transaction.Transaction) []*TxDesc {
+	mp.lock.RLock()
+	defer mp.lock.RUnlock()
+
+	return mp.children(tx)
+}
+
+// 获取交易池中指定交易所依赖的父交易
+func (mp *TxPool) Parents(tx *transaction.Transaction) []*TxDesc {
+	mp.lock.RLock()
+	defer mp.lock.RUnlock()
+
+	return mp.parents(tx)
+}
+
+// 淘汰在交易池中超过最长保存时间的交易及其后代交易, 调用者需持有交易池的锁
+func (mp *TxPool) expireOld() {
+	if mp.config.MaxTxAge <= 0 {
+		return
+	}
+
+	now := mp.config.Clock.Now()
+	for _, desc := range mp.pool {
+		if now.Sub(desc.Added) > mp.config.MaxTxAge {
+			mp.removeTransaction(desc.Tx, true)
+		}
+	}
+}
+
+// 交易池超过大小限制时, 依次淘汰手续费率最低的交易及其后代交易, 调用者需持有交易池的锁
+func (mp *TxPool) trimToSize() {
+	if mp.config.MaxPoolSize <= 0 || mp.totalSize <= mp.config.MaxPoolSize {
+		return
+	}
+
+	// 按手续费率从低到高排列, 手续费率相同时先淘汰后加入的交易
+	descs := mp.sortedDescs()
+	for i := len(descs) - 1; i >= 0 && mp.totalSize > mp.config.MaxPoolSize; i-- {
+		mp.removeTransaction(descs[i].Tx, true)
+	}
+}
+
+// 按手续费率从高到低排列交易池中的交易, 手续费率相同时按加入的顺序排列, 调用者需持有交易池的锁
+func (mp *TxPool) sortedDescs() []*TxDesc {
+	descs := make([]*TxDesc, 0, len(mp.pool))
+	for _, desc := range mp.pool {
+		descs = append(descs, desc)
+	}
+
+	sort.Slice(descs, func(i, j int) bool {
+		if descs[i].FeePerKB != descs[j].FeePerKB {
+			return descs[i].FeePerKB > descs[j].FeePerKB
+		}
+		return descs[i].seq < descs[j].seq
+	})
+
+	return descs
+}
+
+/*
+	summary：按手续费率从高到低为区块模板选择交易, 父交易总是排在子交易之前
+	return: 交易池中的全部交易, 由区块组装时根据区块大小等限制截取
+*/
+func (mp *TxPool) SelectTransactions() []*transaction.Transaction {
+	mp.lock.RLock()
+	defer mp.lock.RUnlock()
+
+	remaining := mp.sortedDescs()
+	selected := make([]*transaction.Transaction, 0, len(remaining))
+	included := make(map[string]bool)
+
+	// 每次选择手续费率最高且父交易均已被选择的交易
+	for len(remaining) > 0 {
+		for i, desc := range remaining {
+			ready := true
+			for _, parent := range mp.parents(desc.Tx) {
+				if !included[hex.EncodeToString(parent.Tx.ID)] {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				selected = append(selected, desc.Tx)
+				included[hex.EncodeToString(desc.Tx.ID)] = true
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return selected
+}
+
+/*
+	summary：区块连接到主链后更新交易池: 删除区块中已打包的交易, 以及与区块中的交易花费同一个输出的冲突交易
+	被打包交易的子交易仍然有效, 保留在交易池中; 冲突交易的后代交易一并删除
+*/
+func (mp *TxPool) HandleConnectedBlock(block *blockchain.Block) {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	for _, tx := range block.Transactions {
+		if tx.IsCoinBase() {
+			continue
+		}
+
+		mp.removeTransaction(tx, false)
+
+		for _, vin := range tx.Vin {
+			if conflict, ok := mp.outpoints[outpointKey(vin.TXid, vin.VoutIndex)]; ok {
+				mp.removeTransaction(conflict.Tx, true)
+			}
+		}
+	}
+}
+
+// 按加入的顺序重新验证交易池中的全部交易, 删除无效的交易, 用于区块链切换分叉链等最新区块变化之后
+func (mp *TxPool) Revalidate() {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	mp.revalidate(nil)
+}
+
+/*
+	summary：区块链切换分叉链后更新交易池: 将被断开区块中的非coinbase交易放回交易池, 再重新验证原有的全部交易
+	blocks: 被断开的区块(从新到旧)
+	被断开的交易先于原有交易验证, 以便依赖这些交易输出的交易池交易仍然有效; 已被新主链打包或与其冲突的交易不会放回
+*/
+func (mp *TxPool) HandleDisconnectedBlocks(blocks []*blockchain.Block) {
+	mp.lock.Lock()
+	defer mp.lock.Unlock()
+
+	// 从旧到新依次放回区块中的交易, 同一区块中父交易总在子交易之前
+	var restored []*transaction.Transaction
+	for i := len(blocks) - 1; i >= 0; i-- {
+		for _, tx := range blocks[i].Transactions {
+			if !tx.IsCoinBase() {
+				restored = append(restored, tx)
+			}
+		}
+	}
+
+	mp.revalidate(restored)
+}
+
+// 先验证待放回的交易, 再按加入的顺序重新验证交易池中的全部交易, 调用者需持有交易池的锁
+func (mp *TxPool) revalidate(restored []*transaction.Transaction) {
+	descs := make([]*TxDesc, 0, len(mp.pool))
+	for _, desc := range mp.pool {
+		descs = append(descs, desc)
+	}
+
+	sort.Slice(descs, func(i, j int) bool {
+		return descs[i].seq < descs[j].seq
+	})
+
+	mp.pool = make(map[string]*TxDesc)
+	mp.outpoints = make(map[string]*TxDesc)
+	mp.totalSize = 0
+
+	for _, tx := range restored {
+		_, err := mp.maybeAcceptTransaction(tx)
+		if err != nil {
+			fmt.Printf("被断开区块中的交易 %x 未放回交易池: %s\n", tx.ID, err)
+			continue
+		}
+	}
+
+	for _, desc := range descs {
+		newDesc, err := mp.maybeAcceptTransaction(desc.Tx)
+		if err != nil {
+			fmt.Printf("交易 %x 已失效, 从交易池中删除: %s\n", desc.Tx.ID, err)
+			continue
+		}
+
+		// 保留交易最初加入交易池的时间
+		newDesc.Added = desc.Added
+	}
+}
+
+// 判断交易是否在交易池中
+func (mp *TxPool) HaveTransaction(txID []byte) bool {
+	mp.lock.RLock()
+	defer mp.lock.RUnlock()
+
+	_, ok := mp.pool[hex.EncodeToString(txID)]
+	return ok
+}
+
+// 根据交易ID获取交易池中的交易
+func (mp *TxPool) FetchTransaction(txID []byte) (*transaction.Transaction, bool) {
+	mp.lock.RLock()
+	defer mp.lock.RUnlock()
+
+	desc, ok := mp.pool[hex.EncodeToString(txID)]
+	if !ok {
+		return nil, false
+	}
+
+	return desc.Tx, true
+}
+
+// 获取交易池中全部交易的信息, 按加入的顺序排列
+func (mp *TxPool) TxDescs() []*TxDesc {
+	mp.lock.RLock()
+	defer mp.lock.RUnlock()
+
+	descs := make([]*TxDesc, 0, len(mp.pool))
+	for _, desc := range mp.pool {
+		descs = append(descs, desc)
+	}
+
+	sort.Slice(descs, func(i, j int) bool {
+		return descs[i].seq < descs[j].seq
+	})
+
+	return descs
+}
+
+// 获取交易池中的交易数量
+func (mp *TxPool) Count() int {
+	mp.lock.RLock()
+	defer mp.lock.RUnlock()
+
+	return len(mp.pool)
+}
+
+// 获取交易池中交易序列化后的总字节数
+func (mp *TxPool) Size() int {
+	mp.lock.RLock()
+	defer mp.lock.RUnlock()
+
+	return mp.totalSize
+}
@@ -0,0 +1,586 @@
+/*
+  脚本解释器：基于栈执行解锁脚本和锁定脚本，支持压入数据、流程控制、栈操作、比较、算术、哈希及签名验证操作码，
+  并限制脚本大小、操作码数量、栈深度及单个数据的大小；锁定脚本为支付到脚本Hash时，继续执行解锁脚本最后压入的赎回脚本
+*/
+package script
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"fmt"
+	"golang.org/x/crypto/ripemd160"
+	"math/big"
+)
+
+// 条件分支的执行状态
+const (
+	condFalse = 0 // 当前分支不执行
+	condTrue  = 1 // 当前分支执行
+	condSkip  = 2 // 外层分支不执行, 当前分支的条件不计算
+)
+
+// 脚本解释器
+type Engine struct {
+	scripts     [][]parsedOpcode // 依次执行的脚本: 解锁脚本、锁定脚本, 支付到脚本Hash时还包括赎回脚本
+	dstack      [][]byte         // 数据栈, 最后一个元素为栈顶
+	condStack   []int            // 条件分支栈
+	numOps      int              // 当前脚本已执行的非压入数据操作码数量
+	sigHash     []byte           // 签名验证时被签名的交易Hash
+	payToScript bool             // 锁定脚本是否为支付到脚本Hash
+	savedStack  [][]byte         // 解锁脚本执行后的数据栈, 用于执行赎回脚本
+}
+
+/*
+	summary：构建脚本解释器
+	scriptSig: 输入的解锁脚本, 只能包含压入数据的操作码
+	scriptPubKey: 输入所引用输出的锁定脚本
+	sigHash: 签名验证时被签名的交易Hash
+*/
+func NewEngine(scriptSig, scriptPubKey, sigHash []byte) (*Engine, error) {
+	if !IsPushOnly(scriptSig) {
+		return nil, scriptError(ErrNotPushOnly, "解锁脚本只能包含压入数据的操作码")
+	}
+
+	sigPops, err := parseScript(scriptSig)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKeyPops, err := parseScript(scriptPubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Engine{
+		scripts:     [][]parsedOpcode{sigPops, pubKeyPops},
+		sigHash:     sigHash,
+		payToScript: IsPayToScriptHash(scriptPubKey),
+	}, nil
+}
+
+/*
+	summary：依次执行解锁脚本和锁定脚本, 执行完成后栈顶元素为true时返回nil
+	锁定脚本为支付到脚本Hash时, 锁定脚本只验证赎回脚本的Hash, 验证通过后以解锁脚本执行后的数据栈(去掉赎回脚本)继续执行赎回脚本
+*/
+func (vm *Engine) Execute() error {
+	for idx := 0; idx < len(vm.scripts); idx++ {
+		vm.numOps = 0
+
+		for _, pop := range vm.scripts[idx] {
+			err := vm.step(pop)
+			if err != nil {
+				return err
+			}
+
+			if len(vm.dstack) > MaxStackSize {
+				return scriptError(ErrStackOverflow, fmt.Sprintf("栈中元素数量 %d 超过最大数量 %d", len(vm.dstack), MaxStackSize))
+			}
+		}
+
+		// 每个脚本中的条件操作码必须配对
+		if len(vm.condStack) != 0 {
+			return scriptError(ErrUnbalancedConditional, "脚本结束时存在未结束的OP_IF")
+		}
+
+		if !vm.payToScript {
+			continue
+		}
+
+		switch idx {
+		case 0:
+			vm.savedStack = append([][]byte{}, vm.dstack...)
+		case 1:
+			err := vm.checkFinalStack()
+			if err != nil {
+				return err
+			}
+
+			// 锁定脚本已验证赎回脚本的Hash, 解锁脚本至少压入了赎回脚本
+			redeemScript := vm.savedStack[len(vm.savedStack) - 1]
+			redeemPops, err := parseScript(redeemScript)
+			if err != nil {
+				return err
+			}
+
+			vm.scripts = append(vm.scripts, redeemPops)
+			vm.dstack = vm.savedStack[:len(vm.savedStack) - 1]
+		}
+	}
+
+	return vm.checkFinalStack()
+}
+
+// 栈为空或栈顶元素为false时脚本执行失败
+func (vm *Engine) checkFinalStack() error {
+	if len(vm.dstack) == 0 || !asBool(vm.dstack[len(vm.dstack) - 1]) {
+		return scriptError(ErrEvalFalse, "脚本执行完成后栈为空或栈顶元素为false")
+	}
+
+	return nil
+}
+
+// 执行解锁脚本和锁定脚本, 验证输入是否能够花费输出
+func Verify(scriptSig, scriptPubKey, sigHash []byte) error {
+	vm, err := NewEngine(scriptSig, scriptPubKey, sigHash)
+	if err != nil {
+		return err
+	}
+
+	return vm.Execute()
+}
+
+// 当前是否处于执行的分支中
+func (vm *Engine) isBranchExecuting() bool {
+	return len(vm.condStack) == 0 || vm.condStack[len(vm.condStack) - 1] == condTrue
+}
+
+// 执行单个操作码
+func (vm *Engine) step(pop parsedOpcode) error {
+	if len(pop.data) > MaxScriptElementSize {
+		return scriptError(ErrElementTooBig, fmt.Sprintf("压入的数据大小 %d 超过最大字节数 %d", len(pop.data), MaxScriptElementSize))
+	}
+
+	if !isPushOpcode(pop.opcode) {
+		vm.numOps++
+		if vm.numOps > MaxOpsPerScript {
+			return scriptError(ErrTooManyOperations, fmt.Sprintf("脚本中的操作码数量超过最大数量 %d", MaxOpsPerScript))
+		}
+	}
+
+	// 不执行的分支中只处理条件操作码
+	if !vm.isBranchExecuting() && !isConditional(pop.opcode) {
+		return nil
+	}
+
+	switch {
+	case pop.opcode == OP_0:
+		vm.push([]byte{})
+		return nil
+	case pop.opcode >= OP_DATA_1 && pop.opcode <= OP_PUSHDATA2:
+		vm.push(pop.data)
+		return nil
+	case pop.opcode == OP_1NEGATE:
+		vm.pushNum(-1)
+		return nil
+	case pop.opcode >= OP_1 && pop.opcode <= OP_16:
+		vm.pushNum(scriptNum(pop.opcode - OP_1 + 1))
+		return nil
+	}
+
+	switch pop.opcode {
+	case OP_NOP:
+		return nil
+	case OP_IF, OP_NOTIF:
+		return vm.opIf(pop.opcode == OP_NOTIF)
+	case OP_ELSE:
+		if len(vm.condStack) == 0 {
+			return scriptError(ErrUnbalancedConditional, "OP_ELSE 没有对应的OP_IF")
+		}
+
+		top := len(vm.condStack) - 1
+		switch vm.condStack[top] {
+		case condTrue:
+			vm.condStack[top] = condFalse
+		case condFalse:
+			vm.condStack[top] = condTrue
+		}
+		return nil
+	case OP_ENDIF:
+		if len(vm.condStack) == 0 {
+			return scriptError(ErrUnbalancedConditional, "OP_ENDIF 没有对应的OP_IF")
+		}
+
+		vm.condStack = vm.condStack[:len(vm.condStack) - 1]
+		return nil
+	case OP_VERIFY:
+		return vm.verify("OP_VERIFY")
+	case OP_RETURN:
+		return scriptError(ErrEarlyReturn, "执行了OP_RETURN")
+	}
+
+	if op, ok := stackOps[pop.opcode]; ok {
+		return op(vm)
+	}
+
+	if op, ok := numericOps[pop.opcode]; ok {
+		return vm.opNumeric(pop.opcode, op)
+	}
+
+	switch pop.opcode {
+	case OP_EQUAL, OP_EQUALVERIFY:
+		data, err := vm.popN(2)
+		if err != nil {
+			return err
+		}
+
+		vm.push(fromBool(bytes.Equal(data[0], data[1])))
+		if pop.opcode == OP_EQUALVERIFY {
+			return vm.verify("OP_EQUALVERIFY")
+		}
+		return nil
+	case OP_RIPEMD160, OP_SHA256, OP_HASH160, OP_HASH256:
+		data, err := vm.popN(1)
+		if err != nil {
+			return err
+		}
+
+		vm.push(hashData(pop.opcode, data[0]))
+		return nil
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		data, err := vm.popN(2)
+		if err != nil {
+			return err
+		}
+
+		vm.push(fromBool(checkSignature(data[0], data[1], vm.sigHash)))
+		if pop.opcode == OP_CHECKSIGVERIFY {
+			return vm.verify("OP_CHECKSIGVERIFY")
+		}
+		return nil
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		err := vm.opCheckMultiSig()
+		if err != nil {
+			return err
+		}
+
+		if pop.opcode == OP_CHECKMULTISIGVERIFY {
+			return vm.verify("OP_CHECKMULTISIGVERIFY")
+		}
+		return nil
+	}
+
+	return scriptError(ErrReservedOpcode, fmt.Sprintf("执行了未定义的操作码 %s", opcodeName(pop.opcode)))
+}
+
+// 处理OP_IF及OP_NOTIF: 外层分支执行时根据栈顶元素决定当前分支是否执行
+func (vm *Engine) opIf(notIf bool) error {
+	cond := condSkip
+	if vm.isBranchExecuting() {
+		data, err := vm.popN(1)
+		if err != nil {
+			return err
+		}
+
+		cond = condFalse
+		if asBool(data[0]) != notIf {
+			cond = condTrue
+		}
+	}
+
+	vm.condStack = append(vm.condStack, cond)
+	return nil
+}
+
+// 弹出栈顶元素, 为false时返回验证失败
+func (vm *Engine) verify(name string) error {
+	data, err := vm.popN(1)
+	if err != nil {
+		return err
+	}
+
+	if !asBool(data[0]) {
+		return scriptError(ErrVerify, fmt.Sprintf("%s 验证失败", name))
+	}
+
+	return nil
+}
+
+// 压入数据
+func (vm *Engine) push(data []byte) {
+	vm.dstack = append(vm.dstack, data)
+}
+
+// 压入数字
+func (vm *Engine) pushNum(n scriptNum) {
+	vm.push(n.Bytes())
+}
+
+// 弹出栈顶的n个元素, 按压入的顺序返回
+func (vm *Engine) popN(n int) ([][]byte, error) {
+	if len(vm.dstack) < n {
+		return nil, scriptError(ErrInvalidStackOperation, fmt.Sprintf("栈中元素数量 %d 不足 %d 个", len(vm.dstack), n))
+	}
+
+	data := append([][]byte{}, vm.dstack[len(vm.dstack) - n:]...)
+	vm.dstack = vm.dstack[:len(vm.dstack) - n]
+	return data, nil
+}
+
+// 栈操作码
+var stackOps = map[byte]func(vm *Engine) error{
+	OP_DROP: func(vm *Engine) error {
+		_, err := vm.popN(1)
+		return err
+	},
+	OP_2DROP: func(vm *Engine) error {
+		_, err := vm.popN(2)
+		return err
+	},
+	OP_DUP: func(vm *Engine) error {
+		data, err := vm.popN(1)
+		if err != nil {
+			return err
+		}
+		vm.push(data[0])
+		vm.push(data[0])
+		return nil
+	},
+	OP_2DUP: func(vm *Engine) error {
+		data, err := vm.popN(2)
+		if err != nil {
+			return err
+		}
+		vm.push(data[0])
+		vm.push(data[1])
+		vm.push(data[0])
+		vm.push(data[1])
+		return nil
+	},
+	OP_NIP: func(vm *Engine) error {
+		data, err := vm.popN(2)
+		if err != nil {
+			return err
+		}
+		vm.push(data[1])
+		return nil
+	},
+	OP_OVER: func(vm *Engine) error {
+		data, err := vm.popN(2)
+		if err != nil {
+			return err
+		}
+		vm.push(data[0])
+		vm.push(data[1])
+		vm.push(data[0])
+		return nil
+	},
+	OP_SWAP: func(vm *Engine) error {
+		data, err := vm.popN(2)
+		if err != nil {
+			return err
+		}
+		vm.push(data[1])
+		vm.push(data[0])
+		return nil
+	},
+	OP_DEPTH: func(vm *Engine) error {
+		vm.pushNum(scriptNum(len(vm.dstack)))
+		return nil
+	},
+	OP_SIZE: func(vm *Engine) error {
+		if len(vm.dstack) == 0 {
+			return scriptError(ErrInvalidStackOperation, "OP_SIZE 需要栈中至少有1个元素")
+		}
+		vm.pushNum(scriptNum(len(vm.dstack[len(vm.dstack) - 1])))
+		return nil
+	},
+}
+
+// 算术操作码: 操作数个数及计算函数
+type numericOp struct {
+	operands int
+	apply    func(args []scriptNum) scriptNum
+}
+
+// 将布尔值转为脚本数字
+func boolNum(value bool) scriptNum {
+	if value {
+		return 1
+	}
+
+	return 0
+}
+
+// 算术操作码
+var numericOps = map[byte]numericOp{
+	OP_1ADD:      {1, func(a []scriptNum) scriptNum { return a[0] + 1 }},
+	OP_1SUB:      {1, func(a []scriptNum) scriptNum { return a[0] - 1 }},
+	OP_NEGATE:    {1, func(a []scriptNum) scriptNum { return -a[0] }},
+	OP_ABS: {1, func(a []scriptNum) scriptNum {
+		if a[0] < 0 {
+			return -a[0]
+		}
+		return a[0]
+	}},
+	OP_NOT:                {1, func(a []scriptNum) scriptNum { return boolNum(a[0] == 0) }},
+	OP_0NOTEQUAL:          {1, func(a []scriptNum) scriptNum { return boolNum(a[0] != 0) }},
+	OP_ADD:                {2, func(a []scriptNum) scriptNum { return a[0] + a[1] }},
+	OP_SUB:                {2, func(a []scriptNum) scriptNum { return a[0] - a[1] }},
+	OP_BOOLAND:            {2, func(a []scriptNum) scriptNum { return boolNum(a[0] != 0 && a[1] != 0) }},
+	OP_BOOLOR:             {2, func(a []scriptNum) scriptNum { return boolNum(a[0] != 0 || a[1] != 0) }},
+	OP_NUMEQUAL:           {2, func(a []scriptNum) scriptNum { return boolNum(a[0] == a[1]) }},
+	OP_NUMEQUALVERIFY:     {2, func(a []scriptNum) scriptNum { return boolNum(a[0] == a[1]) }},
+	OP_NUMNOTEQUAL:        {2, func(a []scriptNum) scriptNum { return boolNum(a[0] != a[1]) }},
+	OP_LESSTHAN:           {2, func(a []scriptNum) scriptNum { return boolNum(a[0] < a[1]) }},
+	OP_GREATERTHAN:        {2, func(a []scriptNum) scriptNum { return boolNum(a[0] > a[1]) }},
+	OP_LESSTHANOREQUAL:    {2, func(a []scriptNum) scriptNum { return boolNum(a[0] <= a[1]) }},
+	OP_GREATERTHANOREQUAL: {2, func(a []scriptNum) scriptNum { return boolNum(a[0] >= a[1]) }},
+	OP_MIN: {2, func(a []scriptNum) scriptNum {
+		if a[0] < a[1] {
+			return a[0]
+		}
+		return a[1]
+	}},
+	OP_MAX: {2, func(a []scriptNum) scriptNum {
+		if a[0] > a[1] {
+			return a[0]
+		}
+		return a[1]
+	}},
+	// x min max: x 在 [min, max) 范围内时为1
+	OP_WITHIN: {3, func(a []scriptNum) scriptNum { return boolNum(a[1] <= a[0] && a[0] < a[2]) }},
+}
+
+// 执行算术操作码: 弹出操作数并解码为数字, 压入计算结果
+func (vm *Engine) opNumeric(opcode byte, op numericOp) error {
+	data, err := vm.popN(op.operands)
+	if err != nil {
+		return err
+	}
+
+	args := make([]scriptNum, len(data))
+	for i, d := range data {
+		args[i], err = makeScriptNum(d)
+		if err != nil {
+			return err
+		}
+	}
+
+	vm.pushNum(op.apply(args))
+	if opcode == OP_NUMEQUALVERIFY {
+		return vm.verify("OP_NUMEQUALVERIFY")
+	}
+
+	return nil
+}
+
+/*
+	summary：执行OP_CHECKMULTISIG, 验证M个签名是否分别对应N个公钥中的M个, 签名的顺序必须与公钥的顺序一致
+	栈中依次为: <dummy> <签名1>...<签名M> M <公钥1>...<公钥N> N, 与比特币相同会多弹出一个元素(dummy), 该元素必须为空
+	每个公钥计为一个操作码
+*/
+func (vm *Engine) opCheckMultiSig() error {
+	numPubKeys, err := vm.popInt()
+	if err != nil {
+		return err
+	}
+
+	if numPubKeys < 0 || numPubKeys > MaxPubKeysPerMultiSig {
+		return scriptError(ErrInvalidPubKeyCount, fmt.Sprintf("多重签名的公钥数量 %d 不在 0~%d 范围内", numPubKeys, MaxPubKeysPerMultiSig))
+	}
+
+	vm.numOps += numPubKeys
+	if vm.numOps > MaxOpsPerScript {
+		return scriptError(ErrTooManyOperations, fmt.Sprintf("脚本中的操作码数量超过最大数量 %d", MaxOpsPerScript))
+	}
+
+	pubkeys, err := vm.popN(numPubKeys)
+	if err != nil {
+		return err
+	}
+
+	numSignatures, err := vm.popInt()
+	if err != nil {
+		return err
+	}
+
+	if numSignatures < 0 || numSignatures > numPubKeys {
+		return scriptError(ErrInvalidSignatureCount, fmt.Sprintf("多重签名的签名数量 %d 不在 0~%d 范围内", numSignatures, numPubKeys))
+	}
+
+	signatures, err := vm.popN(numSignatures)
+	if err != nil {
+		return err
+	}
+
+	dummy, err := vm.popN(1)
+	if err != nil {
+		return err
+	}
+
+	if len(dummy[0]) != 0 {
+		return scriptError(ErrSigNullDummy, "OP_CHECKMULTISIG 多弹出的元素不为空")
+	}
+
+	// 按顺序为每个签名查找对应的公钥, 剩余的公钥少于剩余的签名时验证失败
+	success := true
+	for sigIdx, keyIdx := 0, 0; sigIdx < len(signatures); keyIdx++ {
+		if len(signatures) - sigIdx > len(pubkeys) - keyIdx {
+			success = false
+			break
+		}
+
+		if checkSignature(signatures[sigIdx], pubkeys[keyIdx], vm.sigHash) {
+			sigIdx++
+		}
+	}
+
+	vm.push(fromBool(success))
+	return nil
+}
+
+// 弹出栈顶元素并解码为整数
+func (vm *Engine) popInt() (int, error) {
+	data, err := vm.popN(1)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := makeScriptNum(data[0])
+	return int(n), err
+}
+
+// 计算哈希操作码的结果
+func hashData(opcode byte, data []byte) []byte {
+	switch opcode {
+	case OP_RIPEMD160:
+		return calcRipemd160(data)
+	case OP_SHA256:
+		hash := sha256.Sum256(data)
+		return hash[:]
+	case OP_HASH160:
+		return Hash160(data)
+	default:
+		firstHash := sha256.Sum256(data)
+		secondHash := sha256.Sum256(firstHash[:])
+		return secondHash[:]
+	}
+}
+
+// 计算RIPEMD160
+func calcRipemd160(data []byte) []byte {
+	hasher := ripemd160.New()
+	hasher.Write(data)
+	return hasher.Sum(nil)
+}
+
+// 计算RIPEMD160(SHA256(data)), 与钱包计算公钥Hash的方式相同
+func Hash160(data []byte) []byte {
+	hash := sha256.Sum256(data)
+	return calcRipemd160(hash[:])
+}
+
+/*
+	summary：验证签名, 签名及公钥格式错误时验证失败
+	sig: 签名, 由r和s各补齐32个字节拼接而成
+	pubkey: 公钥, 由椭圆曲线上的x和y各补齐32个字节拼接而成
+	hash: 被签名的交易Hash
+*/
+func checkSignature(sig, pubkey, hash []byte) bool {
+	if len(sig) != 64 || len(pubkey) != 64 {
+		return false
+	}
+
+	curve := elliptic.P256()
+	x := new(big.Int).SetBytes(pubkey[:32])
+	y := new(big.Int).SetBytes(pubkey[32:])
+	if !curve.IsOnCurve(x, y) {
+		return false
+	}
+
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	return ecdsa.Verify(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, hash, r, s)
+}
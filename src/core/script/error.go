@@ -0,0 +1,109 @@
+package script
+
+import "fmt"
+
+// 脚本解析或执行失败的错误码
+type ErrorCode int
+
+const (
+	// 脚本超过最大字节数
+	ErrScriptTooBig ErrorCode = iota
+
+	// 脚本格式错误, 例如压入数据的长度超过脚本剩余的字节数
+	ErrMalformedPush
+
+	// 压入栈的数据超过最大字节数
+	ErrElementTooBig
+
+	// 脚本中非压入数据的操作码数量超过限制
+	ErrTooManyOperations
+
+	// 栈中元素数量超过限制
+	ErrStackOverflow
+
+	// 栈中元素数量不足以执行操作码
+	ErrInvalidStackOperation
+
+	// 解锁脚本只能包含压入数据的操作码
+	ErrNotPushOnly
+
+	// 执行了未定义或禁用的操作码
+	ErrReservedOpcode
+
+	// 条件操作码(OP_IF/OP_ELSE/OP_ENDIF)不配对
+	ErrUnbalancedConditional
+
+	// 执行了OP_RETURN
+	ErrEarlyReturn
+
+	// OP_VERIFY及*VERIFY类操作码验证失败
+	ErrVerify
+
+	// 数字超过4个字节
+	ErrNumberTooBig
+
+	// 脚本执行完成后栈为空或栈顶元素为false
+	ErrEvalFalse
+
+	// 多重签名的公钥数量超出范围
+	ErrInvalidPubKeyCount
+
+	// 多重签名的签名数量超出范围
+	ErrInvalidSignatureCount
+
+	// OP_CHECKMULTISIG 多弹出的元素不为空
+	ErrSigNullDummy
+
+	// 脚本不是标准的多重签名脚本或多重签名解锁脚本
+	ErrNotMultiSig
+
+	// 多重签名解锁脚本中的签名无效或已满足所需数量
+	ErrInvalidMultiSig
+)
+
+// 错误码对应的字符串
+var errorCodeStrings = map[ErrorCode]string{
+	ErrScriptTooBig:          "ErrScriptTooBig",
+	ErrMalformedPush:         "ErrMalformedPush",
+	ErrElementTooBig:         "ErrElementTooBig",
+	ErrTooManyOperations:     "ErrTooManyOperations",
+	ErrStackOverflow:         "ErrStackOverflow",
+	ErrInvalidStackOperation: "ErrInvalidStackOperation",
+	ErrNotPushOnly:           "ErrNotPushOnly",
+	ErrReservedOpcode:        "ErrReservedOpcode",
+	ErrUnbalancedConditional: "ErrUnbalancedConditional",
+	ErrEarlyReturn:           "ErrEarlyReturn",
+	ErrVerify:                "ErrVerify",
+	ErrNumberTooBig:          "ErrNumberTooBig",
+	ErrEvalFalse:             "ErrEvalFalse",
+	ErrInvalidPubKeyCount:    "ErrInvalidPubKeyCount",
+	ErrInvalidSignatureCount: "ErrInvalidSignatureCount",
+	ErrSigNullDummy:          "ErrSigNullDummy",
+	ErrNotMultiSig:           "ErrNotMultiSig",
+	ErrInvalidMultiSig:       "ErrInvalidMultiSig",
+}
+
+// 打印错误码
+func (e ErrorCode) String() string {
+	if s := errorCodeStrings[e]; s != "" {
+		return s
+	}
+
+	return fmt.Sprintf("Unknown ErrorCode (%d)", int(e))
+}
+
+// 脚本解析或执行失败的错误, 通过错误码区分具体的原因
+type Error struct {
+	ErrorCode   ErrorCode // 错误码
+	Description string    // 错误描述
+}
+
+// 实现error接口
+func (e Error) Error() string {
+	return e.Description
+}
+
+// 构建脚本错误
+func scriptError(code ErrorCode, desc string) Error {
+	return Error{ErrorCode: code, Description: desc}
+}
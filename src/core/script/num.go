@@ -0,0 +1,92 @@
+package script
+
+import "fmt"
+
+// 算术操作码的操作数最多占用的字节数
+const maxScriptNumLen = 4
+
+/*
+	脚本数字: 以小端序的符号-数值格式存放在栈中, 最高字节的最高位为符号位
+	例如 1 为 0x01, -1 为 0x81, 128 为 0x8000, 0 为空字节数组
+*/
+type scriptNum int64
+
+// 将脚本数字编码为栈中的字节数组
+func (n scriptNum) Bytes() []byte {
+	if n == 0 {
+		return []byte{}
+	}
+
+	negative := n < 0
+	value := int64(n)
+	if negative {
+		value = -value
+	}
+
+	var result []byte
+	for value > 0 {
+		result = append(result, byte(value & 0xff))
+		value >>= 8
+	}
+
+	// 最高字节的最高位已被占用时增加一个字节存放符号位
+	if result[len(result) - 1] & 0x80 != 0 {
+		extraByte := byte(0x00)
+		if negative {
+			extraByte = 0x80
+		}
+		result = append(result, extraByte)
+	} else if negative {
+		result[len(result) - 1] |= 0x80
+	}
+
+	return result
+}
+
+// 将栈中的字节数组解码为脚本数字, 超过maxScriptNumLen个字节时返回错误
+func makeScriptNum(data []byte) (scriptNum, error) {
+	if len(data) > maxScriptNumLen {
+		return 0, scriptError(ErrNumberTooBig, fmt.Sprintf("数字占用 %d 个字节, 超过最大字节数 %d", len(data), maxScriptNumLen))
+	}
+
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	var result int64
+	for i, b := range data {
+		result |= int64(b) << uint(8 * i)
+	}
+
+	// 最高字节的最高位为符号位
+	if data[len(data) - 1] & 0x80 != 0 {
+		result &= ^(int64(0x80) << uint(8 * (len(data) - 1)))
+		return scriptNum(-result), nil
+	}
+
+	return scriptNum(result), nil
+}
+
+// 将栈中的字节数组转为布尔值, 全为0(包括负0)时为false
+func asBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			// 最后一个字节为0x80且前面全为0时为负0
+			if i == len(data) - 1 && b == 0x80 {
+				return false
+			}
+			return true
+		}
+	}
+
+	return false
+}
+
+// 将布尔值转为栈中的字节数组
+func fromBool(value bool) []byte {
+	if value {
+		return []byte{1}
+	}
+
+	return []byte{}
+}
@@ -0,0 +1,155 @@
+package script
+
+import "fmt"
+
+// 操作码, 与比特币脚本的操作码取值相同
+const (
+	OP_0         = 0x00 // 压入空字节数组, 即数字0或false
+	OP_FALSE     = 0x00
+	OP_DATA_1    = 0x01 // 0x01~0x4b: 压入随后的1~75个字节
+	OP_DATA_20   = 0x14
+	OP_DATA_75   = 0x4b
+	OP_PUSHDATA1 = 0x4c // 随后1个字节表示压入数据的长度
+	OP_PUSHDATA2 = 0x4d // 随后2个字节(小端序)表示压入数据的长度
+	OP_1NEGATE   = 0x4f // 压入数字-1
+	OP_1         = 0x51 // 0x51~0x60: 压入数字1~16
+	OP_TRUE      = 0x51
+	OP_2         = 0x52
+	OP_3         = 0x53
+	OP_16        = 0x60
+
+	// 流程控制
+	OP_NOP    = 0x61
+	OP_IF     = 0x63
+	OP_NOTIF  = 0x64
+	OP_ELSE   = 0x67
+	OP_ENDIF  = 0x68
+	OP_VERIFY = 0x69
+	OP_RETURN = 0x6a
+
+	// 栈操作
+	OP_2DROP = 0x6d
+	OP_2DUP  = 0x6e
+	OP_DEPTH = 0x74
+	OP_DROP  = 0x75
+	OP_DUP   = 0x76
+	OP_NIP   = 0x77
+	OP_OVER  = 0x78
+	OP_SWAP  = 0x7c
+	OP_SIZE  = 0x82
+
+	// 比较
+	OP_EQUAL       = 0x87
+	OP_EQUALVERIFY = 0x88
+
+	// 算术运算, 操作数最多4个字节
+	OP_1ADD               = 0x8b
+	OP_1SUB               = 0x8c
+	OP_NEGATE             = 0x8f
+	OP_ABS                = 0x90
+	OP_NOT                = 0x91
+	OP_0NOTEQUAL          = 0x92
+	OP_ADD                = 0x93
+	OP_SUB                = 0x94
+	OP_BOOLAND            = 0x9a
+	OP_BOOLOR             = 0x9b
+	OP_NUMEQUAL           = 0x9c
+	OP_NUMEQUALVERIFY     = 0x9d
+	OP_NUMNOTEQUAL        = 0x9e
+	OP_LESSTHAN           = 0x9f
+	OP_GREATERTHAN        = 0xa0
+	OP_LESSTHANOREQUAL    = 0xa1
+	OP_GREATERTHANOREQUAL = 0xa2
+	OP_MIN                = 0xa3
+	OP_MAX                = 0xa4
+	OP_WITHIN             = 0xa5
+
+	// 哈希及签名验证
+	OP_RIPEMD160      = 0xa6
+	OP_SHA256         = 0xa8
+	OP_HASH160        = 0xa9
+	OP_HASH256        = 0xaa
+	OP_CHECKSIG       = 0xac
+	OP_CHECKSIGVERIFY = 0xad
+
+	// 多重签名验证: <dummy> <签名1>...<签名M> M <公钥1>...<公钥N> N OP_CHECKMULTISIG
+	OP_CHECKMULTISIG       = 0xae
+	OP_CHECKMULTISIGVERIFY = 0xaf
+)
+
+// 操作码名称, 用于反汇编脚本
+var opcodeNames = map[byte]string{
+	OP_0:                   "OP_0",
+	OP_PUSHDATA1:           "OP_PUSHDATA1",
+	OP_PUSHDATA2:           "OP_PUSHDATA2",
+	OP_1NEGATE:             "OP_1NEGATE",
+	OP_NOP:                 "OP_NOP",
+	OP_IF:                  "OP_IF",
+	OP_NOTIF:               "OP_NOTIF",
+	OP_ELSE:                "OP_ELSE",
+	OP_ENDIF:               "OP_ENDIF",
+	OP_VERIFY:              "OP_VERIFY",
+	OP_RETURN:              "OP_RETURN",
+	OP_2DROP:               "OP_2DROP",
+	OP_2DUP:                "OP_2DUP",
+	OP_DEPTH:               "OP_DEPTH",
+	OP_DROP:                "OP_DROP",
+	OP_DUP:                 "OP_DUP",
+	OP_NIP:                 "OP_NIP",
+	OP_OVER:                "OP_OVER",
+	OP_SWAP:                "OP_SWAP",
+	OP_SIZE:                "OP_SIZE",
+	OP_EQUAL:               "OP_EQUAL",
+	OP_EQUALVERIFY:         "OP_EQUALVERIFY",
+	OP_1ADD:                "OP_1ADD",
+	OP_1SUB:                "OP_1SUB",
+	OP_NEGATE:              "OP_NEGATE",
+	OP_ABS:                 "OP_ABS",
+	OP_NOT:                 "OP_NOT",
+	OP_0NOTEQUAL:           "OP_0NOTEQUAL",
+	OP_ADD:                 "OP_ADD",
+	OP_SUB:                 "OP_SUB",
+	OP_BOOLAND:             "OP_BOOLAND",
+	OP_BOOLOR:              "OP_BOOLOR",
+	OP_NUMEQUAL:            "OP_NUMEQUAL",
+	OP_NUMEQUALVERIFY:      "OP_NUMEQUALVERIFY",
+	OP_NUMNOTEQUAL:         "OP_NUMNOTEQUAL",
+	OP_LESSTHAN:            "OP_LESSTHAN",
+	OP_GREATERTHAN:         "OP_GREATERTHAN",
+	OP_LESSTHANOREQUAL:     "OP_LESSTHANOREQUAL",
+	OP_GREATERTHANOREQUAL:  "OP_GREATERTHANOREQUAL",
+	OP_MIN:                 "OP_MIN",
+	OP_MAX:                 "OP_MAX",
+	OP_WITHIN:              "OP_WITHIN",
+	OP_RIPEMD160:           "OP_RIPEMD160",
+	OP_SHA256:              "OP_SHA256",
+	OP_HASH160:             "OP_HASH160",
+	OP_HASH256:             "OP_HASH256",
+	OP_CHECKSIG:            "OP_CHECKSIG",
+	OP_CHECKSIGVERIFY:      "OP_CHECKSIGVERIFY",
+	OP_CHECKMULTISIG:       "OP_CHECKMULTISIG",
+	OP_CHECKMULTISIGVERIFY: "OP_CHECKMULTISIGVERIFY",
+}
+
+// 获取操作码的名称, 未定义的操作码显示为OP_UNKNOWN及其取值
+func opcodeName(opcode byte) string {
+	if name, ok := opcodeNames[opcode]; ok {
+		return name
+	}
+
+	if opcode >= OP_1 && opcode <= OP_16 {
+		return fmt.Sprintf("OP_%d", opcode - OP_1 + 1)
+	}
+
+	return fmt.Sprintf("OP_UNKNOWN%d", opcode)
+}
+
+// 判断操作码是否为压入数据或数字的操作码, 不支持OP_PUSHDATA4(0x4e), 0x50为保留操作码
+func isPushOpcode(opcode byte) bool {
+	return opcode <= OP_16 && opcode != 0x4e && opcode != 0x50
+}
+
+// 判断操作码是否为流程控制的条件操作码, 条件操作码在不执行的分支中也需要处理
+func isConditional(opcode byte) bool {
+	return opcode == OP_IF || opcode == OP_NOTIF || opcode == OP_ELSE || opcode == OP_ENDIF
+}
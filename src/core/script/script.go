@@ -0,0 +1,262 @@
+/*
+  脚本：交易输出由锁定脚本(scriptPubKey)锁定，花费输出的输入需要提供解锁脚本(scriptSig)，
+  依次执行解锁脚本和锁定脚本后栈顶为true时输入有效；本文件负责脚本的解析、构建及反汇编
+*/
+package script
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// 脚本的最大字节数
+const MaxScriptSize = 10000
+
+// 压入栈的单个数据的最大字节数
+const MaxScriptElementSize = 520
+
+// 单个脚本中非压入数据的操作码的最大数量
+const MaxOpsPerScript = 201
+
+// 栈中元素的最大数量
+const MaxStackSize = 1000
+
+// 多重签名的最大公钥数量
+const MaxPubKeysPerMultiSig = 20
+
+// 解析后的操作码
+type parsedOpcode struct {
+	opcode byte
+	data   []byte // 压入数据的操作码所压入的数据
+}
+
+// 将脚本解析为操作码序列
+func parseScript(script []byte) ([]parsedOpcode, error) {
+	if len(script) > MaxScriptSize {
+		return nil, scriptError(ErrScriptTooBig, fmt.Sprintf("脚本大小 %d 超过最大字节数 %d", len(script), MaxScriptSize))
+	}
+
+	var pops []parsedOpcode
+	for i := 0; i < len(script); {
+		opcode := script[i]
+		i++
+
+		// 计算压入数据的长度
+		dataLen := 0
+		switch {
+		case opcode >= OP_DATA_1 && opcode <= OP_DATA_75:
+			dataLen = int(opcode)
+		case opcode == OP_PUSHDATA1:
+			if i + 1 > len(script) {
+				return nil, scriptError(ErrMalformedPush, "OP_PUSHDATA1 缺少数据长度")
+			}
+			dataLen = int(script[i])
+			i++
+		case opcode == OP_PUSHDATA2:
+			if i + 2 > len(script) {
+				return nil, scriptError(ErrMalformedPush, "OP_PUSHDATA2 缺少数据长度")
+			}
+			dataLen = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		}
+
+		if i + dataLen > len(script) {
+			return nil, scriptError(ErrMalformedPush, fmt.Sprintf("%s 需要压入 %d 个字节, 脚本只剩 %d 个字节", opcodeName(opcode), dataLen, len(script) - i))
+		}
+
+		pop := parsedOpcode{opcode: opcode}
+		if dataLen > 0 {
+			pop.data = script[i : i + dataLen]
+		}
+		pops = append(pops, pop)
+		i += dataLen
+	}
+
+	return pops, nil
+}
+
+// 脚本构建器, 按顺序拼接操作码及压入的数据, 出错后忽略后续操作
+type ScriptBuilder struct {
+	script []byte
+	err    error
+}
+
+// 构建空的脚本构建器
+func NewScriptBuilder() *ScriptBuilder {
+	return &ScriptBuilder{}
+}
+
+// 加入操作码
+func (b *ScriptBuilder) AddOp(opcode byte) *ScriptBuilder {
+	if b.err == nil {
+		b.script = append(b.script, opcode)
+	}
+
+	return b
+}
+
+// 加入压入数据的操作码及数据, 根据数据长度选择压入方式
+func (b *ScriptBuilder) AddData(data []byte) *ScriptBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	dataLen := len(data)
+	switch {
+	case dataLen == 0:
+		b.script = append(b.script, OP_0)
+	case dataLen <= OP_DATA_75:
+		b.script = append(b.script, byte(dataLen))
+	case dataLen <= 0xff:
+		b.script = append(b.script, OP_PUSHDATA1, byte(dataLen))
+	case dataLen <= MaxScriptElementSize:
+		b.script = append(b.script, OP_PUSHDATA2, byte(dataLen), byte(dataLen >> 8))
+	default:
+		b.err = scriptError(ErrElementTooBig, fmt.Sprintf("压入的数据大小 %d 超过最大字节数 %d", dataLen, MaxScriptElementSize))
+		return b
+	}
+
+	b.script = append(b.script, data...)
+	return b
+}
+
+// 加入压入数字的操作码, -1及0~16使用对应的操作码, 其他数字以脚本数字的格式压入
+func (b *ScriptBuilder) AddInt64(value int64) *ScriptBuilder {
+	if b.err != nil {
+		return b
+	}
+
+	switch {
+	case value == 0:
+		b.script = append(b.script, OP_0)
+	case value == -1:
+		b.script = append(b.script, OP_1NEGATE)
+	case value >= 1 && value <= 16:
+		b.script = append(b.script, byte(OP_1 - 1 + value))
+	default:
+		return b.AddData(scriptNum(value).Bytes())
+	}
+
+	return b
+}
+
+// 获取构建的脚本
+func (b *ScriptBuilder) Script() ([]byte, error) {
+	if b.err == nil && len(b.script) > MaxScriptSize {
+		b.err = scriptError(ErrScriptTooBig, fmt.Sprintf("脚本大小 %d 超过最大字节数 %d", len(b.script), MaxScriptSize))
+	}
+
+	return b.script, b.err
+}
+
+// 判断脚本是否只包含压入数据的操作码, 无法解析的脚本返回false
+func IsPushOnly(script []byte) bool {
+	pops, err := parseScript(script)
+	if err != nil {
+		return false
+	}
+
+	for _, pop := range pops {
+		if !isPushOpcode(pop.opcode) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// 获取只包含压入数据操作码的脚本压入的全部数据
+func PushedData(script []byte) ([][]byte, error) {
+	pops, err := parseScript(script)
+	if err != nil {
+		return nil, err
+	}
+
+	var data [][]byte
+	for _, pop := range pops {
+		if !isPushOpcode(pop.opcode) {
+			return nil, scriptError(ErrNotPushOnly, fmt.Sprintf("脚本包含非压入数据的操作码 %s", opcodeName(pop.opcode)))
+		}
+
+		switch {
+		case pop.opcode == OP_1NEGATE:
+			data = append(data, scriptNum(-1).Bytes())
+		case pop.opcode >= OP_1 && pop.opcode <= OP_16:
+			data = append(data, scriptNum(int64(pop.opcode - OP_1 + 1)).Bytes())
+		default:
+			data = append(data, pop.data)
+		}
+	}
+
+	return data, nil
+}
+
+// 计算脚本中签名验证操作码的数量, 多重签名验证按最大公钥数量计算, 无法解析的部分不计算
+func GetSigOpCount(script []byte) int {
+	pops, _ := parseScript(script)
+
+	return countSigOps(pops, false)
+}
+
+/*
+	summary：计算花费输出时解锁脚本中签名验证操作码的准确数量
+	花费支付到脚本Hash的输出时, 解锁脚本最后压入的数据为赎回脚本, 计算赎回脚本中的签名验证操作码;
+	赎回脚本中OP_CHECKMULTISIG之前为OP_1~OP_16时按其表示的公钥数量计算; 其他锁定脚本返回0
+*/
+func GetPreciseSigOpCount(scriptSig, scriptPubKey []byte) int {
+	if !IsPayToScriptHash(scriptPubKey) {
+		return 0
+	}
+
+	// 解锁脚本只能包含压入数据的操作码, 否则脚本验证失败
+	pushes, err := PushedData(scriptSig)
+	if err != nil || len(pushes) == 0 {
+		return 0
+	}
+
+	pops, _ := parseScript(pushes[len(pushes) - 1])
+	return countSigOps(pops, true)
+}
+
+// 计算已解析的操作码中签名验证操作码的数量, precise为true时多重签名验证按前一个操作码表示的公钥数量计算
+func countSigOps(pops []parsedOpcode, precise bool) int {
+	sigOps := 0
+	for i, pop := range pops {
+		switch pop.opcode {
+		case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+			sigOps++
+		case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+			if precise && i > 0 {
+				if numPubKeys, ok := smallInt(pops[i - 1].opcode); ok {
+					sigOps += numPubKeys
+					continue
+				}
+			}
+			sigOps += MaxPubKeysPerMultiSig
+		}
+	}
+
+	return sigOps
+}
+
+// 反汇编脚本, 压入的数据显示为16进制字符串, 无法解析的脚本在末尾显示错误
+func DisasmString(script []byte) string {
+	pops, err := parseScript(script)
+
+	var parts []string
+	for _, pop := range pops {
+		if pop.data != nil {
+			parts = append(parts, hex.EncodeToString(pop.data))
+		} else {
+			parts = append(parts, opcodeName(pop.opcode))
+		}
+	}
+
+	if err != nil {
+		parts = append(parts, fmt.Sprintf("[错误: %s]", err))
+	}
+
+	return strings.Join(parts, " ")
+}
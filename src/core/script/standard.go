@@ -0,0 +1,284 @@
+/*
+  标准脚本模板：支付到公钥Hash(P2PKH)、支付到脚本Hash(P2SH)及M-of-N多重签名的锁定脚本和对应的解锁脚本
+*/
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+)
+
+// 公钥Hash及脚本Hash的字节数
+const pubKeyHashLen = 20
+
+// 公钥的字节数, 由椭圆曲线上的x和y各补齐32个字节拼接而成
+const pubKeyLen = 64
+
+/*
+	summary：构建支付到公钥Hash的锁定脚本
+	OP_DUP OP_HASH160 <公钥Hash> OP_EQUALVERIFY OP_CHECKSIG
+*/
+func PayToPubKeyHashScript(pubKeyHash []byte) []byte {
+	script, err := NewScriptBuilder().AddOp(OP_DUP).AddOp(OP_HASH160).AddData(pubKeyHash).
+		AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG).Script()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return script
+}
+
+// 判断锁定脚本是否为支付到公钥Hash的标准脚本
+func IsPayToPubKeyHash(script []byte) bool {
+	return ExtractPubKeyHash(script) != nil
+}
+
+// 获取支付到公钥Hash的锁定脚本中的公钥Hash, 其他脚本返回nil
+func ExtractPubKeyHash(script []byte) []byte {
+	if len(script) != pubKeyHashLen + 5 {
+		return nil
+	}
+
+	if script[0] != OP_DUP || script[1] != OP_HASH160 || script[2] != OP_DATA_20 ||
+		script[pubKeyHashLen + 3] != OP_EQUALVERIFY || script[pubKeyHashLen + 4] != OP_CHECKSIG {
+		return nil
+	}
+
+	return script[3 : pubKeyHashLen + 3]
+}
+
+// 构建花费支付到公钥Hash输出的解锁脚本: <签名> <公钥>
+func SignatureScript(signature, pubkey []byte) []byte {
+	script, err := NewScriptBuilder().AddData(signature).AddData(pubkey).Script()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return script
+}
+
+/*
+	summary：构建支付到脚本Hash的锁定脚本, 花费时需要提供Hash一致的赎回脚本及满足赎回脚本的数据
+	OP_HASH160 <赎回脚本Hash> OP_EQUAL
+*/
+func PayToScriptHashScript(scriptHash []byte) []byte {
+	script, err := NewScriptBuilder().AddOp(OP_HASH160).AddData(scriptHash).AddOp(OP_EQUAL).Script()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	return script
+}
+
+// 判断锁定脚本是否为支付到脚本Hash的标准脚本
+func IsPayToScriptHash(script []byte) bool {
+	return ExtractScriptHash(script) != nil
+}
+
+// 获取支付到脚本Hash的锁定脚本中的赎回脚本Hash, 其他脚本返回nil
+func ExtractScriptHash(script []byte) []byte {
+	if len(script) != pubKeyHashLen + 3 {
+		return nil
+	}
+
+	if script[0] != OP_HASH160 || script[1] != OP_DATA_20 || script[pubKeyHashLen + 2] != OP_EQUAL {
+		return nil
+	}
+
+	return script[2 : pubKeyHashLen + 2]
+}
+
+/*
+	summary：构建M-of-N多重签名的赎回脚本, 需要N个公钥中任意M个公钥的签名才能花费
+	M <公钥1>...<公钥N> N OP_CHECKMULTISIG
+	赎回脚本需要压入解锁脚本, 大小不能超过单个数据的最大字节数
+*/
+func MultiSigScript(required int, pubkeys [][]byte) ([]byte, error) {
+	if len(pubkeys) == 0 || len(pubkeys) > MaxPubKeysPerMultiSig {
+		return nil, scriptError(ErrInvalidPubKeyCount, fmt.Sprintf("多重签名的公钥数量 %d 不在 1~%d 范围内", len(pubkeys), MaxPubKeysPerMultiSig))
+	}
+
+	if required < 1 || required > len(pubkeys) {
+		return nil, scriptError(ErrInvalidSignatureCount, fmt.Sprintf("多重签名所需的签名数量 %d 不在 1~%d 范围内", required, len(pubkeys)))
+	}
+
+	builder := NewScriptBuilder().AddInt64(int64(required))
+	for _, pubkey := range pubkeys {
+		if len(pubkey) != pubKeyLen {
+			return nil, scriptError(ErrNotMultiSig, fmt.Sprintf("公钥 %x 的长度不是 %d 个字节", pubkey, pubKeyLen))
+		}
+		builder.AddData(pubkey)
+	}
+
+	script, err := builder.AddInt64(int64(len(pubkeys))).AddOp(OP_CHECKMULTISIG).Script()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(script) > MaxScriptElementSize {
+		return nil, scriptError(ErrElementTooBig, fmt.Sprintf("多重签名赎回脚本大小 %d 超过最大字节数 %d, 请减少公钥数量", len(script), MaxScriptElementSize))
+	}
+
+	return script, nil
+}
+
+// 解析M-of-N多重签名的赎回脚本, 返回所需的签名数量及全部公钥
+func ExtractMultiSig(script []byte) (int, [][]byte, error) {
+	pops, err := parseScript(script)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	notMultiSig := scriptError(ErrNotMultiSig, "脚本不是标准的多重签名脚本")
+	if len(pops) < 4 || pops[len(pops) - 1].opcode != OP_CHECKMULTISIG {
+		return 0, nil, notMultiSig
+	}
+
+	required, ok := smallInt(pops[0].opcode)
+	numPubKeys, ok2 := smallInt(pops[len(pops) - 2].opcode)
+	if !ok || !ok2 || numPubKeys != len(pops) - 3 || required < 1 || required > numPubKeys {
+		return 0, nil, notMultiSig
+	}
+
+	var pubkeys [][]byte
+	for _, pop := range pops[1 : len(pops) - 2] {
+		if len(pop.data) != pubKeyLen {
+			return 0, nil, notMultiSig
+		}
+		pubkeys = append(pubkeys, pop.data)
+	}
+
+	return required, pubkeys, nil
+}
+
+// 获取OP_1~OP_16表示的数字
+func smallInt(opcode byte) (int, bool) {
+	if opcode < OP_1 || opcode > OP_16 {
+		return 0, false
+	}
+
+	return int(opcode - OP_1 + 1), true
+}
+
+// 构建花费多重签名的支付到脚本Hash输出的解锁脚本: OP_0 <签名1>...<签名K> <赎回脚本>, OP_0为OP_CHECKMULTISIG多弹出的元素
+func MultiSigSignatureScript(signatures [][]byte, redeemScript []byte) ([]byte, error) {
+	builder := NewScriptBuilder().AddOp(OP_0)
+	for _, signature := range signatures {
+		builder.AddData(signature)
+	}
+
+	return builder.AddData(redeemScript).Script()
+}
+
+// 解析多重签名解锁脚本, 返回已有的签名及赎回脚本
+func parseMultiSigSignatureScript(scriptSig []byte) ([][]byte, []byte, error) {
+	pushes, err := PushedData(scriptSig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(pushes) < 2 || len(pushes[0]) != 0 {
+		return nil, nil, scriptError(ErrNotMultiSig, "解锁脚本不是多重签名解锁脚本")
+	}
+
+	return pushes[1 : len(pushes) - 1], pushes[len(pushes) - 1], nil
+}
+
+// 获取多重签名解锁脚本的赎回脚本, 解锁脚本不是多重签名解锁脚本时返回错误
+func MultiSigRedeemScript(scriptSig []byte) ([]byte, error) {
+	_, redeemScript, err := parseMultiSigSignatureScript(scriptSig)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, err = ExtractMultiSig(redeemScript)
+	if err != nil {
+		return nil, err
+	}
+
+	return redeemScript, nil
+}
+
+// 获取多重签名解锁脚本已有的签名数量及所需的签名数量
+func MultiSigProgress(scriptSig []byte) (int, int, error) {
+	signatures, redeemScript, err := parseMultiSigSignatureScript(scriptSig)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	required, _, err := ExtractMultiSig(redeemScript)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return len(signatures), required, nil
+}
+
+/*
+	summary：将一个签名加入多重签名解锁脚本, 多个钱包可以依次加入各自的签名, 签名按赎回脚本中公钥的顺序排列
+	scriptSig: 已有的多重签名解锁脚本, 可以不包含签名
+	sigHash: 被签名的交易Hash, 用于确定已有签名对应的公钥
+	signature: 新的签名
+	pubkey: 新签名对应的公钥, 必须是赎回脚本中的公钥
+	return: 加入签名后的解锁脚本
+*/
+func AddMultiSigSignature(scriptSig, sigHash, signature, pubkey []byte) ([]byte, error) {
+	signatures, redeemScript, err := parseMultiSigSignatureScript(scriptSig)
+	if err != nil {
+		return nil, err
+	}
+
+	required, pubkeys, err := ExtractMultiSig(redeemScript)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(signatures) >= required {
+		return nil, scriptError(ErrInvalidMultiSig, fmt.Sprintf("已有 %d 个签名, 满足所需的签名数量 %d", len(signatures), required))
+	}
+
+	// 已有的签名按顺序对应的公钥
+	keySignatures := make([][]byte, len(pubkeys))
+	for _, sig := range signatures {
+		matched := false
+		for i, key := range pubkeys {
+			if keySignatures[i] == nil && checkSignature(sig, key, sigHash) {
+				keySignatures[i] = sig
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return nil, scriptError(ErrInvalidMultiSig, fmt.Sprintf("签名 %x 不对应赎回脚本中任何未签名的公钥", sig))
+		}
+	}
+
+	// 新签名对应的公钥必须在赎回脚本中且尚未签名, 以免同一钱包重复签名
+	keyIdx := -1
+	for i, key := range pubkeys {
+		if keySignatures[i] == nil && bytes.Equal(key, pubkey) {
+			keyIdx = i
+			break
+		}
+	}
+
+	if keyIdx < 0 {
+		return nil, scriptError(ErrInvalidMultiSig, fmt.Sprintf("公钥 %x 不在赎回脚本中或已签名", pubkey))
+	}
+
+	if !checkSignature(signature, pubkey, sigHash) {
+		return nil, scriptError(ErrInvalidMultiSig, fmt.Sprintf("签名 %x 无效", signature))
+	}
+	keySignatures[keyIdx] = signature
+
+	var ordered [][]byte
+	for _, sig := range keySignatures {
+		if sig != nil {
+			ordered = append(ordered, sig)
+		}
+	}
+
+	return MultiSigSignatureScript(ordered, redeemScript)
+}
@@ -0,0 +1,83 @@
+/*
+  多重签名交易：花费多重签名地址的输出时, 多个钱包依次对交易签名, 签名数量达到赎回脚本要求后交易才有效
+*/
+package transaction
+
+import (
+	"bytes"
+	"core/script"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"log"
+	"utils"
+)
+
+// 构建花费多重签名输出的输入, 解锁脚本中只有赎回脚本, 签名由各钱包通过SignMultiSig加入
+func NewMultiSigTXInput(txID []byte, voutIndex int, redeemScript []byte) (TXInput, error) {
+	scriptSig, err := script.MultiSigSignatureScript(nil, redeemScript)
+	if err != nil {
+		return TXInput{}, err
+	}
+
+	return TXInput{txID, voutIndex, scriptSig}, nil
+}
+
+/*
+	summary：用私钥对交易中花费多重签名输出的输入签名, 并将签名加入输入的解锁脚本
+	被签名的交易Hash与普通交易相同, 由输入引用输出的锁定脚本(赎回脚本的支付到脚本Hash脚本)计算, 签名后重新计算交易ID
+	privateKey: 签名钱包的私钥, 其公钥必须在赎回脚本中
+	return: 签名的输入数量为0时返回错误
+*/
+func (tx *Transaction) SignMultiSig(privateKey ecdsa.PrivateKey) error {
+	pubkey := append(utils.PaddedBytes(privateKey.PublicKey.X, 32), utils.PaddedBytes(privateKey.PublicKey.Y, 32)...)
+
+	signedInputs := 0
+	for inID, vin := range tx.Vin {
+		redeemScript, err := script.MultiSigRedeemScript(vin.ScriptSig)
+		if err != nil {
+			continue
+		}
+
+		// 公钥不在赎回脚本中的输入不签名
+		_, pubkeys, _ := script.ExtractMultiSig(redeemScript)
+		if !containsKey(pubkeys, pubkey) {
+			continue
+		}
+
+		prevScriptPubKey := script.PayToScriptHashScript(script.Hash160(redeemScript))
+		sigHash := tx.SignatureHash(inID, prevScriptPubKey)
+
+		r, s, err := ecdsa.Sign(rand.Reader, &privateKey, sigHash)
+		if err != nil {
+			log.Panic(err)
+		}
+		signature := append(utils.PaddedBytes(r, 32), utils.PaddedBytes(s, 32)...)
+
+		scriptSig, err := script.AddMultiSigSignature(vin.ScriptSig, sigHash, signature, pubkey)
+		if err != nil {
+			return err
+		}
+
+		tx.Vin[inID].ScriptSig = scriptSig
+		signedInputs++
+	}
+
+	if signedInputs == 0 {
+		return errors.New("交易中没有需要该钱包签名的多重签名输入")
+	}
+
+	tx.ID = tx.Hash()
+	return nil
+}
+
+// 判断公钥是否在公钥列表中
+func containsKey(pubkeys [][]byte, pubkey []byte) bool {
+	for _, key := range pubkeys {
+		if bytes.Equal(key, pubkey) {
+			return true
+		}
+	}
+
+	return false
+}
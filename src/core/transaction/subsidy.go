@@ -0,0 +1,58 @@
+/*
+  区块奖励的发行计划：初始奖励每隔固定数量的区块减半，累计发行量不超过总量上限
+*/
+package transaction
+
+import "core/chaincfg"
+
+// 获取指定高度的区块奖励, 累计发行量达到上限后奖励为0
+func GetBlockSubsidy(params *chaincfg.Params, height int32) int {
+	if height < 0 {
+		return 0
+	}
+
+	return GetTotalSupply(params, height) - GetTotalSupply(params, height - 1)
+}
+
+/*
+	summary：计算从创世区块到指定高度（包含）的全部区块奖励之和，即该高度时的累计发行量
+	params: 网络参数, 包含初始奖励、减半周期及总量上限
+	height: 区块高度, 小于0时返回0
+*/
+func GetTotalSupply(params *chaincfg.Params, height int32) int {
+	if height < 0 {
+		return 0
+	}
+
+	// 区块的数量, 创世区块的高度为0
+	blocks := int64(height) + 1
+
+	var supply int64
+	if params.HalvingInterval <= 0 {
+		supply = blocks * int64(params.InitialSubsidy)
+	} else {
+		// 按减半周期逐段累加, 每段的区块奖励相同
+		interval := int64(params.HalvingInterval)
+		for halvings := uint(0); blocks > 0 && halvings < 63; halvings++ {
+			subsidy := int64(params.InitialSubsidy) >> halvings
+			if subsidy == 0 {
+				break
+			}
+
+			count := interval
+			if blocks < count {
+				count = blocks
+			}
+
+			supply += count * subsidy
+			blocks -= count
+		}
+	}
+
+	// 累计发行量不能超过上限
+	if params.MaxSupply > 0 && supply > int64(params.MaxSupply) {
+		supply = int64(params.MaxSupply)
+	}
+
+	return int(supply)
+}
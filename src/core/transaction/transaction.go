@@ -5,20 +5,19 @@ package transaction
 
 import (
 	"bytes"
+	"core/script"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/hex"
 	"fmt"
 	"log"
-	"math/big"
 	"strings"
+	"utils"
 )
 
-const Subsidy = 100
-
 // 交易结构体
 type Transaction struct {
 	ID []byte   // 交易的Hash
@@ -34,18 +33,31 @@ func (tx *Transaction) Hash() []byte {
 	return hash[:]
 }
 
-// 根据私钥对交易进行数据签名
+/*
+	summary：计算输入签名时被签名的交易Hash
+	交易副本中全部输入的解锁脚本置为空, 当前输入的解锁脚本替换为其引用输出的锁定脚本, 再计算副本的Hash
+	inIdx: 输入在交易中的序号
+	prevScriptPubKey: 输入引用的输出的锁定脚本
+*/
+func (tx *Transaction) SignatureHash(inIdx int, prevScriptPubKey []byte) []byte {
+	txCopy := tx.CopyTransaction()
+	txCopy.Vin[inIdx].ScriptSig = prevScriptPubKey
+	return txCopy.Hash()
+}
+
+// 根据私钥对交易进行数据签名, 并将签名和公钥写入输入的解锁脚本
 func (tx *Transaction) Sign(privateKey ecdsa.PrivateKey, prevTXs map[string]Transaction) {
 	// CoinBase交易不用处理签名
 	if tx.IsCoinBase() {
 		return
 	}
 
-	// 构建交易副本
-	txCopy := tx.CopyTransaction()
+	// 公钥是曲线上的x点和y点拼接在一起, x和y各补齐为32个字节
+	pubkey := append(utils.PaddedBytes(privateKey.PublicKey.X, 32), utils.PaddedBytes(privateKey.PublicKey.Y, 32)...)
 
-	// 循环遍历交易的输入
-	for inID, vin := range txCopy.Vin {
+	// 先计算全部输入的签名Hash, 以免写入的解锁脚本影响后续输入的计算(签名Hash中各输入的解锁脚本均为空)
+	sigHashes := make([][]byte, len(tx.Vin))
+	for inID, vin := range tx.Vin {
 		// 将这笔输入的ID转为string
 		vinId := hex.EncodeToString(vin.TXid)
 
@@ -55,42 +67,31 @@ func (tx *Transaction) Sign(privateKey ecdsa.PrivateKey, prevTXs map[string]Tran
 			log.Panic(fmt.Sprintf("未找到输入ID: %s, 所在的交易！", vinId))
 		}
 
-		// 将这笔交易的这笔输入的签名置为nil
-		txCopy.Vin[inID].Signature = nil
-
-		// 这笔交易的这笔输入引用的前一笔交易的输出的公钥哈希
-		txCopy.Vin[inID].Pubkey = prevTx.Vout[vin.VoutIndex].PublicKeyHash
-
-		// 设置交易副本的ID为交易的Hash
-		txCopy.ID = txCopy.Hash()
+		sigHashes[inID] = tx.SignatureHash(inID, prevTx.Vout[vin.VoutIndex].ScriptPubKey)
+	}
 
+	for inID := range tx.Vin {
 		// 数据签名得到椭圆曲线的r和s
-		r, s, err := ecdsa.Sign(rand.Reader, &privateKey, txCopy.ID)
+		r, s, err := ecdsa.Sign(rand.Reader, &privateKey, sigHashes[inID])
 		if err != nil {
 			log.Panic(err)
 		}
 
-		// 交易的数据签名是由 r + s拼接而成
-		signature := append(r.Bytes(), s.Bytes()...)
+		// 交易的数据签名是由 r + s拼接而成, r和s各补齐为32个字节, 保证验证时可以从中间一分为二
+		signature := append(utils.PaddedBytes(r, 32), utils.PaddedBytes(s, 32)...)
 
-		// 将数据签名赋给真实的交易的输入
-		tx.Vin[inID].Signature = signature
+		// 将数据签名和公钥作为真实的交易的输入的解锁脚本
+		tx.Vin[inID].ScriptSig = script.SignatureScript(signature, pubkey)
 	}
 }
 
-// 验证交易是否有效
+// 验证交易是否有效: 依次执行每笔输入的解锁脚本和其引用输出的锁定脚本
 func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
 	// CoinBase 交易不需要验证
 	if tx.IsCoinBase() {
 		return true
 	}
 
-	// 构建交易副本
-	txCopy := tx.CopyTransaction()
-
-	// 构建一个椭圆曲线
-	curve := elliptic.P256()
-
 	for inID, vin := range tx.Vin {
 		// 将这笔输入的ID转为string
 		vinId := hex.EncodeToString(vin.TXid)
@@ -101,75 +102,94 @@ func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
 			log.Panic(fmt.Sprintf("未找到输入ID: %s, 所在的交易！", vinId))
 		}
 
-		// 将这笔交易的这笔输入的签名置为nil
-		txCopy.Vin[inID].Signature = nil
-
-		// 这笔交易的这笔输入引用的前一笔交易的输出的公钥哈希
-		txCopy.Vin[inID].Pubkey = prevTx.Vout[vin.VoutIndex].PublicKeyHash
-
-		// 设置交易副本的ID为交易的Hash
-		txCopy.ID = txCopy.Hash()
-
-		// 用大整数表示椭圆曲线的r和s
-		r := big.Int{}
-		s := big.Int{}
-
-		// 将输入的数据签名一分为二, 分别表示r和s点, 并将[]byte转为大整数
-		signHalfLen := len(vin.Signature) / 2
-		r.SetBytes(vin.Signature[: signHalfLen])
-		s.SetBytes(vin.Signature[signHalfLen : ])
-
-		// 计算公钥的大整数
-		x := big.Int{}
-		y := big.Int{}
-
-		// 将输入的公钥一分为二, 分别表示x和y点, 并将[]byte转为大整数
-		pubkeyHalfLen := len(vin.Pubkey) / 2
-		x.SetBytes(vin.Pubkey[: pubkeyHalfLen])
-		y.SetBytes(vin.Pubkey[pubkeyHalfLen : ])
-
-		// 根据椭圆曲线和x、y轴所在的点构建公钥
-		rawPubkey := ecdsa.PublicKey{curve, &x, &y }
-
-		// 根据公钥、交易hash, 通过椭圆曲线验证数据签名的r和s点是否有效
-		if ecdsa.Verify(&rawPubkey, txCopy.ID, &r, &s) == false {
+		// 锁定脚本决定了花费输出的条件, 例如P2PKH要求公钥与公钥Hash一致且签名有效
+		scriptPubKey := prevTx.Vout[vin.VoutIndex].ScriptPubKey
+		if err := script.Verify(vin.ScriptSig, scriptPubKey, tx.SignatureHash(inID, scriptPubKey)); err != nil {
 			return false
 		}
-
-		// 将交易副本的ID置为空, 以免影响下次循环对交易Hash的计算
-		txCopy.Vin[inID].Pubkey = nil
 	}
 
 	return true
 }
 
-// 构建交易副本
+// 构建交易副本, 副本中输入的解锁脚本为空
 func (tx *Transaction) CopyTransaction() Transaction {
 	var inputs []TXInput
 	var outputs []TXOutput
 
 	for _, vin := range tx.Vin {
-		inputs = append(inputs, TXInput{vin.TXid, vin.VoutIndex, nil, nil})
+		inputs = append(inputs, TXInput{vin.TXid, vin.VoutIndex, nil})
 	}
 
 	for _, vout := range tx.Vout {
-		outputs = append(outputs, TXOutput{vout.Value, vout.PublicKeyHash})
+		outputs = append(outputs, TXOutput{vout.Value, vout.ScriptPubKey})
 	}
 
 	txCopy := Transaction{tx.ID, inputs, outputs}
 	return txCopy
 }
 
-// 交易序列化
+/*
+	summary：交易序列化, 用于计算交易的Hash及交易的大小
+	按固定的字节顺序逐个字段编码, 保证不同节点对同一交易的序列化结果相同
+	(gob编码中包含进程内分配的类型编号, 同一交易在不同进程中的编码结果可能不同)
+*/
 func (tx Transaction) Seialize() []byte {
 	var encoded bytes.Buffer
-	enc := gob.NewEncoder(&encoded)
+
+	writeBytes(&encoded, tx.ID)
+
+	writeUint64(&encoded, uint64(len(tx.Vin)))
+	for _, vin := range tx.Vin {
+		writeBytes(&encoded, vin.TXid)
+		writeUint64(&encoded, uint64(int64(vin.VoutIndex)))
+		writeBytes(&encoded, vin.ScriptSig)
+	}
+
+	writeUint64(&encoded, uint64(len(tx.Vout)))
+	for _, vout := range tx.Vout {
+		writeUint64(&encoded, uint64(int64(vout.Value)))
+		writeBytes(&encoded, vout.ScriptPubKey)
+	}
+
+	return encoded.Bytes()
+}
+
+// 以小端序写入8个字节的整数
+func writeUint64(buff *bytes.Buffer, value uint64) {
+	var data [8]byte
+	binary.LittleEndian.PutUint64(data[:], value)
+	buff.Write(data[:])
+}
+
+// 写入字节数组, 先写入长度再写入内容, 空数组与nil的编码相同
+func writeBytes(buff *bytes.Buffer, data []byte) {
+	writeUint64(buff, uint64(len(data)))
+	buff.Write(data)
+}
+
+// 通过gob序列化交易, 用于在钱包之间传递待签名的交易
+func SerializeTransaction(tx Transaction) []byte {
+	var buff bytes.Buffer
+	enc := gob.NewEncoder(&buff)
 	err := enc.Encode(tx)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	return encoded.Bytes()
+	return buff.Bytes()
+}
+
+// 通过gob反序列化交易, 数据来自其他钱包, 格式错误时返回错误
+func DeserializeTransaction(data []byte) (*Transaction, error) {
+	var tx Transaction
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	err := dec.Decode(&tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tx, nil
 }
 
 // 标准化打印
@@ -181,13 +201,13 @@ func (tx Transaction) String() string {
 		lines = append(lines, fmt.Sprintf("    Input        %d", i))
 		lines = append(lines, fmt.Sprintf("    TXID:        %d:", input.TXid))
 		lines = append(lines, fmt.Sprintf("    Out:         %d:", input.VoutIndex))
-		lines = append(lines, fmt.Sprintf("    Signature:   %x:", input.Signature))
+		lines = append(lines, fmt.Sprintf("    ScriptSig:   %s:", script.DisasmString(input.ScriptSig)))
 	}
 
 	for i, output := range tx.Vout {
 		lines = append(lines, fmt.Sprintf("    Output       %d", i))
 		lines = append(lines, fmt.Sprintf("    Value:       %d:", output.Value))
-		lines = append(lines, fmt.Sprintf("    Script:      %x:", output.PublicKeyHash))
+		lines = append(lines, fmt.Sprintf("    Script:      %s:", script.DisasmString(output.ScriptPubKey)))
 	}
 
 	return strings.Join(lines, "\n")
@@ -199,10 +219,54 @@ func (tx Transaction) IsCoinBase() bool {
 	return len(tx.Vin) == 1 && len(tx.Vin[0].TXid) == 0 && tx.Vin[0].VoutIndex == -1
 }
 
-// 构建第一笔coinbase交易
-func NewCoinBaseTx(to, data string) *Transaction {
-	txin := TXInput{[]byte{}, -1, nil, []byte(data)}
-	txout := NewTXOutput(Subsidy, to)
+// 计算交易的签名操作数量, 即输入的解锁脚本和输出的锁定脚本中签名验证操作码的数量, coinbase交易的输入数据不是脚本, 不计算
+func (tx Transaction) SigOpCount() int {
+	sigOps := 0
+	if !tx.IsCoinBase() {
+		for _, vin := range tx.Vin {
+			sigOps += script.GetSigOpCount(vin.ScriptSig)
+		}
+	}
+
+	for _, vout := range tx.Vout {
+		sigOps += script.GetSigOpCount(vout.ScriptPubKey)
+	}
+
+	return sigOps
+}
+
+// 计算交易花费支付到脚本Hash的输出时赎回脚本中签名验证操作码的数量, prevTXs中只需包含被引用的输出, 未找到的输出不计算
+func (tx Transaction) P2SHSigOpCount(prevTXs map[string]Transaction) int {
+	if tx.IsCoinBase() {
+		return 0
+	}
+
+	sigOps := 0
+	for _, vin := range tx.Vin {
+		prevTx, ok := prevTXs[hex.EncodeToString(vin.TXid)]
+		if !ok || vin.VoutIndex < 0 || vin.VoutIndex >= len(prevTx.Vout) {
+			continue
+		}
+
+		sigOps += script.GetPreciseSigOpCount(vin.ScriptSig, prevTx.Vout[vin.VoutIndex].ScriptPubKey)
+	}
+
+	return sigOps
+}
+
+// 将额外随机数(extra nonce)以小端格式拼接在coinbase交易输入的数据后面, 并重新计算交易ID
+func (tx *Transaction) SetExtraNonce(data []byte, extraNonce uint64) {
+	nonceBytes := make([]byte, 8)
+	binary.LittleEndian.PutUint64(nonceBytes, extraNonce)
+
+	tx.Vin[0].ScriptSig = append(append([]byte{}, data...), nonceBytes...)
+	tx.ID = tx.Hash()
+}
+
+// 构建第一笔coinbase交易, value为支付给矿工的金额
+func NewCoinBaseTx(to, data string, value int) *Transaction {
+	txin := TXInput{[]byte{}, -1, []byte(data)}
+	txout := NewTXOutput(value, to)
 	tx := Transaction{nil, []TXInput{txin}, []TXOutput{*txout}}
 	tx.ID = tx.Hash()
 
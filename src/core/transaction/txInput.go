@@ -2,6 +2,7 @@ package transaction
 
 import (
 	"bytes"
+	"core/script"
 	"core/wallet"
 )
 
@@ -9,12 +10,16 @@ import (
 type TXInput struct {
 	TXid []byte
 	VoutIndex int
-	Signature []byte  // 数据签名
-	Pubkey []byte  // 公钥
+	ScriptSig []byte  // 解锁脚本, 花费P2PKH输出时为 <数据签名> <公钥>, 花费多重签名输出时为 OP_0 <数据签名>... <赎回脚本>
 }
 
-// 判读输入是否属于地址
+// 判读输入是否属于公钥Hash或脚本Hash: 解锁脚本最后压入的数据为公钥或赎回脚本, 其Hash与公钥Hash或脚本Hash一致
 func (in *TXInput) CanUnlockOutputWith(unlockData []byte) bool {
-	lockingHash := wallet.HashPubKey(in.Pubkey)
+	pushes, err := script.PushedData(in.ScriptSig)
+	if err != nil || len(pushes) == 0 {
+		return false
+	}
+
+	lockingHash := wallet.HashPubKey(pushes[len(pushes) - 1])
 	return bytes.Compare(lockingHash, unlockData)  == 0
-}
\ No newline at end of file
+}
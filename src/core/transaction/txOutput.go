@@ -3,29 +3,41 @@ package transaction
 import (
 	"bytes"
 	"core/algorithm"
+	"core/chaincfg"
+	"core/script"
 )
 
 // 交易输出结构体
 type TXOutput struct {
 	Value int
-	PublicKeyHash []byte  // 公钥Hash
+	ScriptPubKey []byte  // 锁定脚本
 }
 
-// 通过地址得到公钥的Hash
-func (out *TXOutput) GetPubkeyHash(address []byte) {
+// 通过地址得到公钥Hash或脚本Hash, 根据地址版本号以支付到公钥Hash或支付到脚本Hash的标准脚本锁定输出
+func (out *TXOutput) Lock(address []byte) {
 	decodeAddress := algorithm.Base58Decode(address)
-	pubkeyHash := decodeAddress[1 : len(decodeAddress) - 4]
-	out.PublicKeyHash = pubkeyHash
+	hash := decodeAddress[1 : len(decodeAddress) - 4]
+
+	if chaincfg.IsScriptHashAddrID(decodeAddress[0]) {
+		out.ScriptPubKey = script.PayToScriptHashScript(hash)
+	} else {
+		out.ScriptPubKey = script.PayToPubKeyHashScript(hash)
+	}
 }
 
-// 判断交易输出是否属于地址
+// 判断交易输出是否属于公钥Hash或脚本Hash, 只识别支付到公钥Hash及支付到脚本Hash的标准脚本
 func (out *TXOutput) CanBeUnlockedWith(pubkeyHash []byte) bool {
-	return bytes.Compare(out.PublicKeyHash, pubkeyHash)  == 0
+	lockingHash := script.ExtractPubKeyHash(out.ScriptPubKey)
+	if lockingHash == nil {
+		lockingHash = script.ExtractScriptHash(out.ScriptPubKey)
+	}
+
+	return lockingHash != nil && bytes.Compare(lockingHash, pubkeyHash)  == 0
 }
 
 // 根据金额和地址，构建一个输出
 func NewTXOutput(value int, address string) *TXOutput {
 	txo := TXOutput{value, nil}
-	txo.GetPubkeyHash([]byte(address))
+	txo.Lock([]byte(address))
 	return &txo
-}
\ No newline at end of file
+}
@@ -8,7 +8,20 @@ import (
 
 // 输出集合
 type TXOutputs struct {
-	Outputs []TXOutput
+	Outputs map[int]TXOutput  // key: 输出在交易中的序号  value: 输出
+	Height int32  // 输出所在交易的区块高度
+	IsCoinbase bool  // 输出所在交易是否为coinbase交易
+}
+
+// 构建空的输出集合
+func NewTXOutputs() TXOutputs {
+	return TXOutputs{Outputs: make(map[int]TXOutput)}
+}
+
+// 判断输出能否被高度为height的区块中的交易花费, coinbase交易的输出需要达到成熟的确认数maturity,
+// 即coinbase交易所在区块之后至少有maturity个区块, 输出才可以被花费
+func (outs TXOutputs) IsMature(height int32, maturity int32) bool {
+	return !outs.IsCoinbase || height - outs.Height >= maturity
 }
 
 // 序列化输出数组
@@ -3,15 +3,26 @@ package wallet
 import (
 	"bytes"
 	"core/algorithm"
+	"core/chaincfg"
 )
 
-// 计算钱包地址
-func (w *Wallet) GetAddress() []byte {
+// 根据网络的地址版本号计算钱包地址（比特币主网的版本号为0，占1个字节）
+func (w *Wallet) GetAddress(params *chaincfg.Params) []byte {
 	// 对公钥取Hash
 	pubkeyHash := HashPubKey(w.PublicKey)
 
+	return encodeAddress(params.PubKeyHashAddrID, pubkeyHash)
+}
+
+// 根据网络的脚本Hash地址版本号计算赎回脚本(例如多重签名脚本)的地址（比特币主网的版本号为5）
+func ScriptHashAddress(params *chaincfg.Params, scriptHash []byte) []byte {
+	return encodeAddress(params.ScriptHashAddrID, scriptHash)
+}
+
+// 对“Version + Hash + CheckSum”进行Base58编码得到地址
+func encodeAddress(version byte, hash []byte) []byte {
 	// 拼接版本号
-	versionPayload := append([]byte{version}, pubkeyHash...)
+	versionPayload := append([]byte{version}, hash...)
 
 	// 计算检查值
 	checksum := checkSum(versionPayload)
@@ -24,11 +35,22 @@ func (w *Wallet) GetAddress() []byte {
 	return address
 }
 
-// 验证地址是否有效
-func ValidateAddress(address []byte) bool {
+// 验证地址是否为指定网络的有效地址(公钥Hash地址或脚本Hash地址), 其他网络的地址版本号不同, 视为无效地址
+func ValidateAddress(params *chaincfg.Params, address []byte) bool {
 	// Base58解码地址得到public hash
 	pubkeyHash := algorithm.Base58Decode(address)
 
+	// 地址至少包含版本1个字节和检查值4个字节
+	if len(pubkeyHash) < 5 {
+		return false
+	}
+
+	// 地址的版本号必须与当前网络一致
+	version := pubkeyHash[0]
+	if version != params.PubKeyHashAddrID && version != params.ScriptHashAddrID {
+		return false
+	}
+
 	// 获取真实检查值（public hash的后4个字节)）
 	actualChecksum := pubkeyHash[len(pubkeyHash) - 4 : ]
 
@@ -40,4 +62,9 @@ func ValidateAddress(address []byte) bool {
 
 	// 比较真实检查值和计算得到的检查值是否相等
 	return bytes.Compare(actualChecksum, targetChecksum)  == 0
-}
\ No newline at end of file
+}
+
+// 判断地址是否为指定网络的有效脚本Hash地址
+func IsScriptHashAddress(params *chaincfg.Params, address []byte) bool {
+	return ValidateAddress(params, address) && algorithm.Base58Decode(address)[0] == params.ScriptHashAddrID
+}
@@ -7,6 +7,7 @@ import (
 	"crypto/sha256"
 	"golang.org/x/crypto/ripemd160"
 	"log"
+	"utils"
 )
 
 // 根据椭圆曲线生成私钥和公钥
@@ -20,8 +21,8 @@ func NewKeyPair() (ecdsa.PrivateKey, []byte) {
 		log.Panic(err)
 	}
 
-	// 生成公钥，公钥是曲线上的x点和y点拼接在一起
-	publicKey := append(privateKey.PublicKey.X.Bytes(), privateKey.PublicKey.Y.Bytes()...)
+	// 生成公钥，公钥是曲线上的x点和y点拼接在一起, x和y各补齐为32个字节
+	publicKey := append(utils.PaddedBytes(privateKey.PublicKey.X, 32), utils.PaddedBytes(privateKey.PublicKey.Y, 32)...)
 	return *privateKey, publicKey
 }
 
@@ -4,9 +4,6 @@ import (
 	"crypto/ecdsa"
 )
 
-// 版本（比特币主网的版本号为0，占1个字节）
-const version = byte(0x00)
-
 // 钱包对象
 type Wallet struct {
 	PrivateKey ecdsa.PrivateKey  // 私钥
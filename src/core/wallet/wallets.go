@@ -2,26 +2,29 @@ package wallet
 
 import (
 	"bytes"
+	"core/chaincfg"
 	"crypto/elliptic"
 	"encoding/gob"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 )
 
-// 存放钱包的文件
+// 存放钱包的文件名, 位于网络的数据目录下
 const walletFile = "wallet.dat"
 
 // 存储钱包的集合的对象
 type Wallets struct {
 	WalletStore map[string]*Wallet  // key: 钱包地址  value:钱包
+	params *chaincfg.Params  // 钱包所属网络的参数, 决定地址版本号及钱包文件位置
 }
 
 // 创建钱包
 func (ws *Wallets) CreateWallet() string {
 	wallet := NewWallet()
-	address := fmt.Sprintf("%s", wallet.GetAddress())
+	address := fmt.Sprintf("%s", wallet.GetAddress(ws.params))
 	ws.WalletStore[address] = wallet
 	return address
 }
@@ -58,7 +61,7 @@ func (ws *Wallets) SaveToFile() {
 	}
 
 	// 将序列化的钱包写入文件 0777 代表文件操作权限
-	err = ioutil.WriteFile(walletFile, content.Bytes(), 0777)
+	err = ioutil.WriteFile(ws.walletFile(), content.Bytes(), 0777)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -67,12 +70,12 @@ func (ws *Wallets) SaveToFile() {
 // 从文件中读取钱包信息到结构体
 func (ws *Wallets) LoadFromFile() error {
 	// 判断文件是否存在, 不存在则返回
-	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
+	if _, err := os.Stat(ws.walletFile()); os.IsNotExist(err) {
 		return err
 	}
 
 	// 读取文件
-	fileContent, err := ioutil.ReadFile(walletFile)
+	fileContent, err := ioutil.ReadFile(ws.walletFile())
 	if err != nil {
 		log.Panic(err)
 	}
@@ -95,11 +98,17 @@ func (ws *Wallets) LoadFromFile() error {
 	return nil
 }
 
-// 构建Wallets对象
-func NewWallets() (*Wallets, error) {
+// 获取钱包文件的路径
+func (ws *Wallets) walletFile() string {
+	return filepath.Join(ws.params.DataDir, walletFile)
+}
+
+// 构建指定网络的Wallets对象
+func NewWallets(params *chaincfg.Params) (*Wallets, error) {
 	// 构建一个空Wallets对象
 	wallets := Wallets{}
 	wallets.WalletStore = make(map[string]*Wallet)
+	wallets.params = params
 
 	// 读取文件内容到Wallets结构体对象
 	err := wallets.LoadFromFile()
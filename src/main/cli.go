@@ -3,17 +3,77 @@ package main
 import (
 	"core/algorithm"
 	"core/blockchain"
+	"core/chaincfg"
+	"core/mempool"
+	"core/script"
 	"core/transaction"
 	"core/wallet"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"server"
+	"strings"
 )
 
 type CLI struct {
 	bc *blockchain.Blockchain
+	params *chaincfg.Params  // 当前命令使用的网络参数
+}
+
+// 获取默认的网络名称, 可通过环境变量NETWORK设置, 未设置时使用主网
+func defaultNetwork() string {
+	if network := os.Getenv("NETWORK"); network != "" {
+		return network
+	}
+
+	return chaincfg.MainNetParams.Name
+}
+
+/*
+	summary：根据网络名称加载网络参数, 并打开该网络的区块链
+	network: 网络名称, 可选 mainnet, testnet, regtest, community, staging
+*/
+func (cli *CLI) configureNetwork(network string) {
+	params, err := chaincfg.ParamsByName(network)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if params != &chaincfg.MainNetParams {
+		fmt.Printf("当前使用网络：%s\n", params.Name)
+	}
+
+	cli.params = params
+	cli.bc = blockchain.NewBlockchain(cli.params)
+	cli.configureSigner()
+}
+
+// 权威证明共识下, 根据环境变量POA_SIGNER(当前节点用于签名的钱包地址)对区块签名, 不设置时只验证区块
+func (cli *CLI) configureSigner() {
+	address := os.Getenv("POA_SIGNER")
+	if cli.params.Consensus != chaincfg.ConsensusPoA || address == "" {
+		return
+	}
+
+	wallets, err := wallet.NewWallets(cli.params)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	w, ok := wallets.WalletStore[address]
+	if !ok {
+		log.Panic("钱包中不存在权威节点的签名地址")
+	}
+
+	engine, err := blockchain.NewEngine(cli.params, &w.PrivateKey)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	cli.bc.SetEngine(engine)
 }
 
 // 验证参数
@@ -30,49 +90,210 @@ func (cli *CLI) validateArgs() {
 // 命令使用说明
 func (cli *CLI) printUsage() {
 	fmt.Println("使用说明")
-	fmt.Println("输入addblock, 增加区块")
+	fmt.Println("输入addblock -address ADDRESS, 增加区块并将挖矿奖励支付给地址")
+	fmt.Println("输入generate -n N -to ADDRESS, 连续挖出N个区块并将挖矿奖励支付给地址")
 	fmt.Println("输入printChain, 打印区块链")
-	fmt.Println("输入getbalance, 查询地址的金额")
+	fmt.Println("输入getbalance -address ADDRESS, 查询地址的可用金额及未成熟的挖矿奖励")
+	fmt.Println("输入getpubkey -address ADDRESS, 查询钱包地址的公钥")
+	fmt.Println("输入getsupply -height HEIGHT, 查询指定高度时的累计发行量, 不指定高度时查询当前最新高度")
+	fmt.Println("输入getdeployments, 查询下一个区块所处的软分叉部署状态")
+	fmt.Println("输入send -from FROM -to TO -amount AMOUNT -fee FEE -mine, 转账并支付手续费, 手续费由打包交易的矿工获得; -mine=false 时将交易发送给中心节点, 由网络中的矿工打包")
+	fmt.Println("输入createmultisig -m M -keys PUBKEY1,PUBKEY2,..., 根据多个公钥创建M-of-N多重签名地址及赎回脚本")
+	fmt.Println("输入createmultisigtx -redeemscript SCRIPT -to TO -amount AMOUNT -fee FEE, 构建花费多重签名地址输出的未签名交易")
+	fmt.Println("输入signmultisigtx -tx TX -address ADDRESS, 用钱包地址的私钥对多重签名交易签名, 签名数量达到M后交易才有效")
+	fmt.Println("输入sendrawtx -tx TX -address ADDRESS -mine, 发送已签名的交易, 在本地挖矿时挖矿奖励支付给地址; -mine=false 时将交易发送给中心节点")
+	fmt.Println("所有命令均可加上 -network NETWORK 选择网络(mainnet, testnet, regtest, community, staging), 默认使用环境变量NETWORK或主网")
 
 }
 
-// 获取地址的金额
+// 获取地址的金额, 未成熟的coinbase金额单独显示
 func (cli *CLI) getBalance(address string) int {
-	balance := 0
+	// 其他网络的地址无效
+	if !wallet.ValidateAddress(cli.params, []byte(address)) {
+		fmt.Printf("地址 %s 不是当前网络 %s 的有效地址\n", address, cli.params.Name)
+		os.Exit(1)
+	}
 
 	// 根据地址转为Pubkey Hash
 	decodeHash := algorithm.Base58Decode([]byte(address))
 	pubkeyHash := decodeHash[1 : len(decodeHash) - 4]
 
 	set := blockchain.NewUTXOSet(cli.bc)
-	UTXOs := set.FindUTXOByPubkeyHash(pubkeyHash)
-	//UTXOs := cli.bc.FindUTXO(pubkeyHash)
+	balance, immature := set.GetBalanceByPubkeyHash(pubkeyHash)
 
-	for _, out := range UTXOs {
-		balance += out.Value
+	fmt.Printf("地址：%s， 可用金额：%d， 未成熟金额：%d\n", address, balance, immature)
+	return balance
+}
+
+// 查询指定高度时的累计发行量, 高度小于0时查询当前最新高度
+func (cli *CLI) getSupply(height int32) {
+	if height < 0 {
+		height = cli.bc.GetBestHeight()
 	}
 
-	fmt.Printf("地址：%s， 拥有金额：%d\n", address, balance)
-	return balance
+	fmt.Printf("区块高度：%d， 区块奖励：%d， 累计发行量：%d， 发行上限：%d\n",
+		height, transaction.GetBlockSubsidy(cli.params, height), transaction.GetTotalSupply(cli.params, height), cli.params.MaxSupply)
 }
 
-// 转账
-func (cli *CLI) send (from, to string, amount int) {
-	// 构建交易
-	tx := blockchain.NewUTXOTransaction(from, to, amount, cli.bc)
-	// 将当前交易记录区块链
-	newbBlock := cli.bc.MineBlock([]*transaction.Transaction{tx})
+// 打印下一个区块所处的软分叉部署状态
+func (cli *CLI) getDeployments() {
+	for id, deployment := range cli.params.Deployments {
+		state, err := cli.bc.DeploymentState(id)
+		if err != nil {
+			log.Panic(err)
+		}
 
-	// 根据区块更新UTXO
-	set := blockchain.NewUTXOSet(cli.bc)
-	set.UpdateUTXOByBlock(newbBlock)
+		fmt.Printf("部署：%s， 表决位：%d， 开始高度：%d， 超时高度：%d， 阈值：%d/%d， 状态：%s\n", deployment.Name, deployment.BitNumber,
+			deployment.StartHeight, deployment.TimeoutHeight, deployment.Threshold, cli.params.MinerConfirmationWindow, state)
+	}
+}
+
+// 转账, 手续费由打包交易的矿工获得; mine为false时不在本地挖矿, 而是将交易发送给中心节点转发
+func (cli *CLI) send (from, to string, amount, fee int, mine bool) {
+	// 构建交易, 由转出地址获得挖矿奖励
+	tx := blockchain.NewUTXOTransaction(from, to, amount, fee, cli.bc)
+	cli.submitTransaction(tx, from, mine)
+}
+
+// 验证交易并放入交易池, mine为true时在本地挖矿打包交易并将挖矿奖励支付给minerAddress, 否则将交易发送给中心节点转发
+func (cli *CLI) submitTransaction(tx *transaction.Transaction, minerAddress string, mine bool) {
+	txPool := mempool.NewTxPool(cli.bc, mempool.DefaultConfig())
+	_, err := txPool.MaybeAcceptTransaction(tx)
+	if err != nil {
+		fmt.Printf("交易无效, 转账失败: %s\n", err)
+		return
+	}
+
+	if !mine {
+		server.SendTransaction(cli.params, tx)
+		fmt.Printf("交易 %x 已发送给中心节点\n", tx.ID)
+		return
+	}
+
+	// 从交易池中选择交易记录区块链(同时更新UTXO)
+	block := cli.bc.MineBlock(minerAddress, txPool.SelectTransactions())
+	txPool.HandleConnectedBlock(block)
 	fmt.Println("转账成功！")
 }
 
+/*
+	summary：根据多个公钥创建M-of-N多重签名地址, 打印地址及赎回脚本, 花费该地址的输出时需要提供赎回脚本
+	required: 所需的签名数量M
+	keys: 逗号分隔的公钥(16进制), 可通过getpubkey查询钱包的公钥
+*/
+func (cli *CLI) createMultiSig(required int, keys string) {
+	var pubkeys [][]byte
+	for _, key := range strings.Split(keys, ",") {
+		pubkey, err := hex.DecodeString(strings.TrimSpace(key))
+		if err != nil {
+			fmt.Printf("公钥 %s 不是有效的16进制字符串\n", key)
+			os.Exit(1)
+		}
+		pubkeys = append(pubkeys, pubkey)
+	}
+
+	redeemScript, err := script.MultiSigScript(required, pubkeys)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%d-of-%d 多重签名地址：%s\n", required, len(pubkeys), wallet.ScriptHashAddress(cli.params, script.Hash160(redeemScript)))
+	fmt.Printf("赎回脚本：%x\n", redeemScript)
+}
+
+// 解析16进制的多重签名赎回脚本
+func parseRedeemScript(redeemScriptHex string) []byte {
+	redeemScript, err := hex.DecodeString(redeemScriptHex)
+	if err == nil {
+		_, _, err = script.ExtractMultiSig(redeemScript)
+	}
+
+	if err != nil {
+		fmt.Printf("赎回脚本无效: %s\n", err)
+		os.Exit(1)
+	}
+
+	return redeemScript
+}
+
+// 解析16进制的交易
+func parseTransaction(txHex string) *transaction.Transaction {
+	data, err := hex.DecodeString(txHex)
+	if err != nil {
+		fmt.Println("交易不是有效的16进制字符串")
+		os.Exit(1)
+	}
+
+	tx, err := transaction.DeserializeTransaction(data)
+	if err != nil {
+		fmt.Printf("交易格式错误: %s\n", err)
+		os.Exit(1)
+	}
+
+	return tx
+}
+
+// 打印交易及每个多重签名输入的签名进度
+func printMultiSigTransaction(tx *transaction.Transaction) {
+	for inID, vin := range tx.Vin {
+		signatures, required, err := script.MultiSigProgress(vin.ScriptSig)
+		if err == nil {
+			fmt.Printf("输入 %d 已有签名：%d/%d\n", inID, signatures, required)
+		}
+	}
+
+	fmt.Printf("交易：%x\n", transaction.SerializeTransaction(*tx))
+}
+
+// 构建花费多重签名地址输出的未签名交易, 打印交易的16进制字符串, 由多个钱包通过signmultisigtx依次签名
+func (cli *CLI) createMultiSigTx(redeemScriptHex, to string, amount, fee int) {
+	tx := blockchain.NewMultiSigTransaction(parseRedeemScript(redeemScriptHex), to, amount, fee, cli.bc)
+	printMultiSigTransaction(tx)
+}
+
+// 用钱包地址的私钥对多重签名交易签名, 打印加入签名后的交易
+func (cli *CLI) signMultiSigTx(txHex, address string) {
+	tx := parseTransaction(txHex)
+
+	wallets, err := wallet.NewWallets(cli.params)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	w, ok := wallets.WalletStore[address]
+	if !ok {
+		fmt.Printf("钱包中不存在地址：%s\n", address)
+		os.Exit(1)
+	}
+
+	err = tx.SignMultiSig(w.PrivateKey)
+	if err != nil {
+		fmt.Printf("签名失败: %s\n", err)
+		os.Exit(1)
+	}
+
+	printMultiSigTransaction(tx)
+}
+
+// 发送已签名的交易, mine为true时在本地挖矿打包交易并将挖矿奖励支付给minerAddress
+func (cli *CLI) sendRawTx(txHex, minerAddress string, mine bool) {
+	cli.submitTransaction(parseTransaction(txHex), minerAddress, mine)
+}
+
+// 连续挖出n个区块, 挖矿奖励支付给地址
+func (cli *CLI) generate(n int, address string) {
+	for i := 0; i < n; i++ {
+		block := cli.bc.MineBlock(address, []*transaction.Transaction{})
+		fmt.Printf("已生成区块, 高度：%d， Hash：%x\n", block.Height, block.Hash)
+	}
+}
+
 // 创建钱包, 并存储到文件中
 func (cli *CLI) createWallet() {
-	wallets, err := wallet.NewWallets()
-	if err != nil {
+	// 钱包文件不存在时创建新的钱包文件
+	wallets, err := wallet.NewWallets(cli.params)
+	if err != nil && !os.IsNotExist(err) {
 		log.Panic(err)
 	}
 
@@ -81,8 +302,24 @@ func (cli *CLI) createWallet() {
 	fmt.Printf("你的钱包地址是：%s\n", address)
 }
 
+// 打印钱包地址对应的公钥, 用于配置权威证明的权威节点
+func (cli *CLI) getPubkey(address string) {
+	wallets, err := wallet.NewWallets(cli.params)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	w, ok := wallets.WalletStore[address]
+	if !ok {
+		fmt.Printf("钱包中不存在地址：%s\n", address)
+		os.Exit(1)
+	}
+
+	fmt.Printf("地址：%s， 公钥：%x\n", address, w.PublicKey)
+}
+
 func (cli *CLI) listAddress() {
-	wallets, err := wallet.NewWallets()
+	wallets, err := wallet.NewWallets(cli.params)
 	if err != nil {
 		log.Panic(err)
 	}
@@ -96,7 +333,7 @@ func (cli *CLI) listAddress() {
 func (cli *CLI) startNode(nodeId, minnerAddress string) {
 	fmt.Printf("开始运行节点：%s\n", nodeId)
 	if len(minnerAddress) >0 {
-		if wallet.ValidateAddress([]byte(minnerAddress)) {
+		if wallet.ValidateAddress(cli.params, []byte(minnerAddress)) {
 			fmt.Printf("%s 矿工正在运行\n", minnerAddress)
 		} else {
 			log.Panic("矿工地址不合法")
@@ -104,7 +341,7 @@ func (cli *CLI) startNode(nodeId, minnerAddress string) {
 	}
 
 	// 运行服务
-	server.StrartServer(nodeId, minnerAddress, cli.bc)
+	server.StrartServer(cli.params, nodeId, minnerAddress, cli.bc)
 }
 
 func (cli *CLI) Run() {
@@ -112,26 +349,70 @@ func (cli *CLI) Run() {
 	cli.validateArgs()
 
 	addBlockCmd := flag.NewFlagSet("addblock", flag.ExitOnError)
+	addBlockAddress := addBlockCmd.String("address", "", "请输入获得挖矿奖励的地址")
+	generateCmd := flag.NewFlagSet("generate", flag.ExitOnError)
+	generateNum := generateCmd.Int("n", 1, "请输入挖出的区块数量")
+	generateTo := generateCmd.String("to", "", "请输入获得挖矿奖励的地址")
 	printChainCmd := flag.NewFlagSet("printChain", flag.ExitOnError)
-	getBalanceCmd := flag.NewFlagSet("getbalace", flag.ExitOnError)
+	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
+	getBalanceAddress := getBalanceCmd.String("address", "", "请输入查询金额的地址")
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
 	listAddressCmd := flag.NewFlagSet("listaddress", flag.ExitOnError)
+	getPubkeyCmd := flag.NewFlagSet("getpubkey", flag.ExitOnError)
+	getPubkeyAddress := getPubkeyCmd.String("address", "", "请输入查询公钥的钱包地址")
 	getBestHeightCmd := flag.NewFlagSet("getbestheight", flag.ExitOnError)
+	getSupplyCmd := flag.NewFlagSet("getsupply", flag.ExitOnError)
+	getSupplyHeight := getSupplyCmd.Int("height", -1, "请输入查询累计发行量的区块高度")
+	getDeploymentsCmd := flag.NewFlagSet("getdeployments", flag.ExitOnError)
 
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
 	sendFrom := sendCmd.String("from", "", "请输入转账的转出地址")
 	sendTo := sendCmd.String("to", "", "请输入转账的转入地址")
 	sendAmount := sendCmd.Int("amount", 0, "请输入转账的金额")
+	sendFee := sendCmd.Int("fee", 0, "请输入交易手续费")
+	sendMine := sendCmd.Bool("mine", true, "是否在本地立即挖矿打包交易")
+
+	createMultiSigCmd := flag.NewFlagSet("createmultisig", flag.ExitOnError)
+	createMultiSigRequired := createMultiSigCmd.Int("m", 0, "请输入所需的签名数量")
+	createMultiSigKeys := createMultiSigCmd.String("keys", "", "请输入逗号分隔的公钥(16进制)")
+
+	createMultiSigTxCmd := flag.NewFlagSet("createmultisigtx", flag.ExitOnError)
+	createMultiSigTxScript := createMultiSigTxCmd.String("redeemscript", "", "请输入多重签名的赎回脚本(16进制)")
+	createMultiSigTxTo := createMultiSigTxCmd.String("to", "", "请输入转账的转入地址")
+	createMultiSigTxAmount := createMultiSigTxCmd.Int("amount", 0, "请输入转账的金额")
+	createMultiSigTxFee := createMultiSigTxCmd.Int("fee", 0, "请输入交易手续费")
+
+	signMultiSigTxCmd := flag.NewFlagSet("signmultisigtx", flag.ExitOnError)
+	signMultiSigTxTx := signMultiSigTxCmd.String("tx", "", "请输入待签名的交易(16进制)")
+	signMultiSigTxAddress := signMultiSigTxCmd.String("address", "", "请输入签名的钱包地址")
+
+	sendRawTxCmd := flag.NewFlagSet("sendrawtx", flag.ExitOnError)
+	sendRawTxTx := sendRawTxCmd.String("tx", "", "请输入已签名的交易(16进制)")
+	sendRawTxAddress := sendRawTxCmd.String("address", "", "请输入获得挖矿奖励的地址")
+	sendRawTxMine := sendRawTxCmd.Bool("mine", true, "是否在本地立即挖矿打包交易")
 
 	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
 	startNodeMinner := startNodeCmd.String("minner", "", "请输入矿工的地址")
 
+	// 每个命令都可以通过 -network 选择网络 key: 命令名称
+	networks := make(map[string]*string)
+	for _, cmd := range []*flag.FlagSet{addBlockCmd, generateCmd, printChainCmd, getBalanceCmd, createWalletCmd, listAddressCmd,
+		getPubkeyCmd, getBestHeightCmd, getSupplyCmd, getDeploymentsCmd, sendCmd, createMultiSigCmd, createMultiSigTxCmd,
+		signMultiSigTxCmd, sendRawTxCmd, startNodeCmd} {
+		networks[cmd.Name()] = cmd.String("network", defaultNetwork(), "请输入网络名称(mainnet, testnet, regtest, community, staging)")
+	}
+
 	switch os.Args[1] {
 	case "addblock":
 		err := addBlockCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "generate":
+		err := generateCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "printChain":
 		err := printChainCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -147,6 +428,16 @@ func (cli *CLI) Run() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "getsupply":
+		err := getSupplyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "getdeployments":
+		err := getDeploymentsCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "send":
 		err := sendCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -162,6 +453,31 @@ func (cli *CLI) Run() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "getpubkey":
+		err := getPubkeyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "createmultisig":
+		err := createMultiSigCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "createmultisigtx":
+		err := createMultiSigTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "signmultisigtx":
+		err := signMultiSigTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "sendrawtx":
+		err := sendRawTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "startnode":
 		err := startNodeCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -172,8 +488,25 @@ func (cli *CLI) Run() {
 		os.Exit(1)
 	}
 
+	// 根据命令的 -network 参数加载网络参数并打开区块链
+	cli.configureNetwork(*networks[os.Args[1]])
+
 	if addBlockCmd.Parsed() {
-		cli.bc.MineBlock([]*transaction.Transaction{})
+		if !wallet.ValidateAddress(cli.params, []byte(*addBlockAddress)) {
+			fmt.Println("请输入获得挖矿奖励的有效地址")
+			os.Exit(1)
+		}
+
+		cli.bc.MineBlock(*addBlockAddress, []*transaction.Transaction{})
+	}
+
+	if generateCmd.Parsed() {
+		if *generateNum <= 0 || *generateTo == "" || !wallet.ValidateAddress(cli.params, []byte(*generateTo)) {
+			fmt.Println("请输入挖出的区块数量及获得挖矿奖励的有效地址")
+			os.Exit(1)
+		}
+
+		cli.generate(*generateNum, *generateTo)
 	}
 
 	if printChainCmd.Parsed() {
@@ -181,7 +514,6 @@ func (cli *CLI) Run() {
 	}
 
 	if getBalanceCmd.Parsed() {
-		getBalanceAddress := getBalanceCmd.String("address", "", "请输入查询金额的地址")
 		if *getBalanceAddress == "" {
 			fmt.Println("请输入查询金额的地址")
 			os.Exit(1)
@@ -194,12 +526,37 @@ func (cli *CLI) Run() {
 		fmt.Printf("当前区块链最大高度：%d\n", cli.bc.GetBestHeight())
 	}
 
+	if getSupplyCmd.Parsed() {
+		cli.getSupply(int32(*getSupplyHeight))
+	}
+
+	if getDeploymentsCmd.Parsed() {
+		cli.getDeployments()
+	}
+
 	if sendCmd.Parsed() {
 		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
 			os.Exit(1)
 		}
 
-		cli.send(*sendFrom, *sendTo, *sendAmount)
+		if *sendFee < 0 {
+			fmt.Println("交易手续费不能为负数")
+			os.Exit(1)
+		}
+
+		// 转出及转入地址必须是当前网络的地址
+		if !wallet.ValidateAddress(cli.params, []byte(*sendFrom)) || !wallet.ValidateAddress(cli.params, []byte(*sendTo)) {
+			fmt.Printf("请输入当前网络 %s 的有效地址\n", cli.params.Name)
+			os.Exit(1)
+		}
+
+		// 多重签名地址需要多个钱包签名
+		if wallet.IsScriptHashAddress(cli.params, []byte(*sendFrom)) {
+			fmt.Println("转出地址为多重签名地址, 请使用 createmultisigtx 及 signmultisigtx 转账")
+			os.Exit(1)
+		}
+
+		cli.send(*sendFrom, *sendTo, *sendAmount, *sendFee, *sendMine)
 	}
 
 	if createWalletCmd.Parsed() {
@@ -210,12 +567,71 @@ func (cli *CLI) Run() {
 		cli.listAddress()
 	}
 
+	if getPubkeyCmd.Parsed() {
+		if *getPubkeyAddress == "" {
+			fmt.Println("请输入查询公钥的钱包地址")
+			os.Exit(1)
+		}
+
+		cli.getPubkey(*getPubkeyAddress)
+	}
+
+	if createMultiSigCmd.Parsed() {
+		if *createMultiSigRequired <= 0 || *createMultiSigKeys == "" {
+			fmt.Println("请输入所需的签名数量及公钥")
+			os.Exit(1)
+		}
+
+		cli.createMultiSig(*createMultiSigRequired, *createMultiSigKeys)
+	}
+
+	if createMultiSigTxCmd.Parsed() {
+		if *createMultiSigTxScript == "" || *createMultiSigTxTo == "" || *createMultiSigTxAmount <= 0 {
+			fmt.Println("请输入赎回脚本、转入地址及转账金额")
+			os.Exit(1)
+		}
+
+		if *createMultiSigTxFee < 0 {
+			fmt.Println("交易手续费不能为负数")
+			os.Exit(1)
+		}
+
+		if !wallet.ValidateAddress(cli.params, []byte(*createMultiSigTxTo)) {
+			fmt.Printf("请输入当前网络 %s 的有效地址\n", cli.params.Name)
+			os.Exit(1)
+		}
+
+		cli.createMultiSigTx(*createMultiSigTxScript, *createMultiSigTxTo, *createMultiSigTxAmount, *createMultiSigTxFee)
+	}
+
+	if signMultiSigTxCmd.Parsed() {
+		if *signMultiSigTxTx == "" || *signMultiSigTxAddress == "" {
+			fmt.Println("请输入待签名的交易及签名的钱包地址")
+			os.Exit(1)
+		}
+
+		cli.signMultiSigTx(*signMultiSigTxTx, *signMultiSigTxAddress)
+	}
+
+	if sendRawTxCmd.Parsed() {
+		if *sendRawTxTx == "" {
+			fmt.Println("请输入已签名的交易")
+			os.Exit(1)
+		}
+
+		if *sendRawTxMine && !wallet.ValidateAddress(cli.params, []byte(*sendRawTxAddress)) {
+			fmt.Println("在本地挖矿时请输入获得挖矿奖励的有效地址")
+			os.Exit(1)
+		}
+
+		cli.sendRawTx(*sendRawTxTx, *sendRawTxAddress, *sendRawTxMine)
+	}
+
 	if startNodeCmd.Parsed() {
-		//  通过系统环境变量获取节点ID
+		//  通过系统环境变量获取节点ID, 未设置时使用网络的默认端口
 		nodeID := os.Getenv("NODE_ID")
 		if nodeID == "" {
-			fmt.Println("当前节点ID未设置")
-			os.Exit(1)
+			nodeID = cli.params.DefaultPort
 		}
 
 		cli.startNode(nodeID, *startNodeMinner)
@@ -18,8 +18,8 @@ func main() {
 	//test.TestBoltDB()
 	//test.TestWallet()
 
-	bc := blockchain.NewBlockchain("1FdsuGae3QNWcJLg2yKNQ1vZkZ5Cdg3KUm")
-	cli := CLI{bc}
+	// 区块链在解析命令的 -network 参数后打开
+	cli := CLI{}
 	cli.Run()
 }
 
@@ -1,6 +1,9 @@
 package server
 
-import "fmt"
+import (
+	"encoding/binary"
+	"fmt"
+)
 
 // 判断当前外部节点是否已在已知节点集合里
 func nodeIsKnow(address string) bool {
@@ -13,6 +16,13 @@ func nodeIsKnow(address string) bool {
 	return false
 }
 
+// 当前网络的魔数, 以小端序放在每个请求的开头
+func networkMagic() []byte {
+	magic := make([]byte, magicLength)
+	binary.LittleEndian.PutUint32(magic, chainParams.Net)
+	return magic
+}
+
 // string命令转为字节数组
 func commandToBytes(command string) []byte {
 	var bytes [commandLength]byte
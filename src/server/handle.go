@@ -5,9 +5,12 @@ import (
 	"core/blockchain"
 	"encoding/gob"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"math/big"
 	"net"
+	"time"
 )
 
 // 存放当前节点已有的区块的Hash
@@ -15,32 +18,56 @@ var blockInTransit [][]byte
 
 // 处理请求连接var
 func handleConnection(conn net.Conn, bc *blockchain.Blockchain) {
-	// 读取请求发送的数据
-	request, err := ioutil.ReadAll(conn)
+	// 读取请求发送的数据, 最多读取maxMessageSize+1个字节, 超过maxMessageSize的请求直接丢弃
+	request, err := ioutil.ReadAll(io.LimitReader(conn, maxMessageSize + 1))
 	if err != nil {
 		log.Panic(err)
 	}
 
+	if len(request) > maxMessageSize {
+		fmt.Printf("请求超过最大字节数 %d, 已丢弃\n", maxMessageSize)
+		return
+	}
+
+	if len(request) < magicLength + commandLength {
+		return
+	}
+
+	// 丢弃其他网络的请求, 并去掉请求开头的网络魔数
+	if !bytes.Equal(request[:magicLength], networkMagic()) {
+		fmt.Printf("请求的网络魔数 %x 与当前网络 %s 不一致, 已丢弃\n", request[:magicLength], chainParams.Name)
+		return
+	}
+	request = request[magicLength:]
+
 	// 获取指令
 	command := bytesToCommand(request[:commandLength])
 
 	// 根据命令处理不同的逻辑
 	switch command {
 	case "version":
-		handleVersion(request, bc)
+		handleVersion(request, conn, bc)
 	case "inventory":
 		handleInventory(request, bc)
 	case "getblockchain":
 		handleGetBlockchain(request, bc)
 	case "getblock":
 		handleGetBlock(request, bc)
+	case "getheaders":
+		handleGetHeaders(request, bc)
+	case "headers":
+		handleHeaders(request, bc)
 	case "sendblock":
 		handleSendBlock(request, bc)
+	case "getdata":
+		handleGetData(request)
+	case "tx":
+		handleTx(request)
 	}
 }
 
-// 处理接收到的区块版本信息
-func handleVersion(request []byte, bc *blockchain.Blockchain) {
+// 处理接收到的区块版本信息, conn为请求的连接, 用于获取外部节点的远程主机
+func handleVersion(request []byte, conn net.Conn, bc *blockchain.Blockchain) {
 	var payload Version
 	var buff bytes.Buffer
 	buff.Write(request[commandLength:])
@@ -53,16 +80,23 @@ func handleVersion(request []byte, bc *blockchain.Blockchain) {
 	// 打印接受到的区块链版本信息
 	payload.String()
 
-	// 当前节点的区块链高度
-	myBestHeight := bc.GetBestHeight()
+	// 记录外部节点的时间, 用于计算网络调整时间; 每个远程主机只记录一个样本, 节点声明的地址可以任意伪造
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		host = conn.RemoteAddr().String()
+	}
+	bc.TimeSource().AddTimeSample(host, time.Unix(payload.Timestamp, 0))
+
+	// 当前节点的区块链累计工作量
+	myBestWork := bc.GetBestWork()
 
-	// 外部节点的区块链高度
-	foreignerBestHeight := payload.BestHeight
+	// 外部节点的区块链累计工作量
+	foreignerBestWork := new(big.Int).SetBytes(payload.BestWork)
 
 	// 当前节点小于外部节点, 则发送获取区块的请求
-	if myBestHeight < foreignerBestHeight {
+	if myBestWork.Cmp(foreignerBestWork) < 0 {
 		sendGetBlockChain(payload.AddrFrom)
-	} else { // 当前节点大于或等于外部节点的区块链高度, 则只需要向外部节点发送当前节点的区块链版本信息
+	} else if myBestWork.Cmp(foreignerBestWork) > 0 { // 当前节点大于外部节点的区块链累计工作量, 则只需要向外部节点发送当前节点的区块链版本信息
 		sendVersion(payload.AddrFrom, bc)
 	}
 
@@ -86,25 +120,44 @@ func handleInventory(request []byte, bc *blockchain.Blockchain) {
 	fmt.Printf("接收到区块清单, 版本: %s, 区块个数: %d\n", payload.Type, len(payload.AllBlocksHash))
 
 	if payload.Type == "block" {
-		blockInTransit = payload.AllBlocksHash
+		// 区块清单是从最新区块往前排列的, 这里倒序遍历并剔除当前节点已有的区块,
+		// 保证先获取前一区块, 接收区块时才能根据前一区块验证其难度
+		newInTransit := [][]byte{}
+		for i := len(payload.AllBlocksHash) - 1; i >= 0; i-- {
+			blockHash := payload.AllBlocksHash[i]
+			if _, err := bc.GetBlockById(blockHash); err != nil {
+				newInTransit = append(newInTransit, blockHash)
+			}
+		}
 
-		// 0号Hash表示外部节点的最后一个区块的Hash, 即最新的区块（区块的遍历是从后往前遍历）
-		blockHash := payload.AllBlocksHash[0]
+		// 当前节点已有全部区块
+		if len(newInTransit) == 0 {
+			return
+		}
 
-		// 发送数据获取最新的区块
-		senGetBlockData(payload.AddrFrom, "block", blockHash)
+		// 设置了假定有效区块时先同步区块头, 验证区块头后再获取区块
+		if bc.NeedHeaders() {
+			blockInTransit = newInTransit
+			sendGetHeaders(payload.AddrFrom, bc.HeaderLocator())
+			return
+		}
 
-		// 循环遍历当前节点已有的区块
-		newInTransit := [][]byte{}
-		for _, b := range blockInTransit {
-			// 从当前已有的区块的Hash集合中，剔除已获取的最新区块
-			if bytes.Compare(b, blockHash) != 0 {
-				newInTransit = append(newInTransit, b)
+		// 发送数据获取最早缺失的区块
+		senGetBlockData(payload.AddrFrom, "block", newInTransit[0])
+
+		// 更新待获取区块Hash集合, 剔除已请求的区块
+		blockInTransit = newInTransit[1:]
+	}
+
+	if payload.Type == "tx" {
+		// 只请求交易池中没有、未见过且最近未被拒绝的交易
+		for _, txID := range payload.AllBlocksHash {
+			if txPool.HaveTransaction(txID) || haveSeenTx(txID) || haveRejectedTx(txID) {
+				continue
 			}
-		}
 
-		// 更新当前节点已有区块Hash集合
-		blockInTransit = newInTransit
+			sendGetData(payload.AddrFrom, "tx", txID)
+		}
 	}
 }
 
@@ -147,8 +200,58 @@ func handleGetBlock(request []byte, bc *blockchain.Blockchain) {
 	}
 }
 
+// 处理发送区块头的请求
+func handleGetHeaders(request []byte, bc *blockchain.Blockchain) {
+	var payload GetHeaders
+	var buff bytes.Buffer
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	sendHeaders(payload.AddrFrom, bc.GetHeaders(payload.StartHash))
+}
+
+// 处理外部节点发送的区块头, 区块头未到达假定有效区块时继续请求, 否则开始获取区块
+func handleHeaders(request []byte, bc *blockchain.Blockchain) {
+	var payload Headers
+	var buff bytes.Buffer
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("接收到区块头, 个数: %d\n", len(payload.Headers))
+
+	// 区块头验证失败时不再请求区块头, 获取的区块全部验证签名
+	err = bc.ProcessHeaders(payload.Headers)
+	if err != nil {
+		fmt.Printf("拒绝区块头: %s\n", err)
+	} else if bc.NeedHeaders() && len(payload.Headers) == blockchain.MaxHeadersPerMsg {
+		sendGetHeaders(payload.AddrFrom, bc.HeaderLocator())
+		return
+	}
+
+	// 发送数据获取最早缺失的区块
+	if len(blockInTransit) > 0 {
+		senGetBlockData(payload.AddrFrom, "block", blockInTransit[0])
+		blockInTransit = blockInTransit[1:]
+	}
+}
+
 // 处理外部节点发送的区块
 func handleSendBlock(request []byte, bc *blockchain.Blockchain) {
+	// 解码之前先检查请求大小: 区块的gob编码不超过按固定格式计算的区块大小加上类型信息等开销,
+	// 超过的请求一定不是有效区块; 区块大小限制在验证区块时按固定格式检查
+	if len(request) - commandLength > blockchain.MaxBlockSize + sendBlockOverhead {
+		fmt.Printf("拒绝区块: 请求大小 %d 超过区块大小限制\n", len(request) - commandLength)
+		return
+	}
+
 	var buff bytes.Buffer
 	var payload SendBlock
 	buff.Write(request[commandLength:])
@@ -164,10 +267,39 @@ func handleSendBlock(request []byte, bc *blockchain.Blockchain) {
 	// 反序列化得到区块
 	block := blockchain.DeserializeBlock(blockData)
 
-	// 将区块加入当前区块链
-	bc.AddBlock(block)
+	// 将区块加入当前区块链, 未通过共识规则验证的区块不会加入
+	prevTip := bc.GetCurrentHash()
+	isOrphan, err := bc.ProcessBlock(block)
+	if err != nil {
+		fmt.Printf("拒绝区块 %x: %s\n", block.Hash, err)
+		return
+	}
 	fmt.Printf("已接收到区块: %x\n", block.Hash)
 
+	// 区块为孤块, 向发送节点请求缺失的前一区块
+	if isOrphan {
+		senGetBlockData(payload.AddrFrom, "block", bc.GetMissingParent(block.Hash))
+		return
+	}
+
+	// 最新区块已变化, 停止在旧区块上挖矿, 清空最近被拒绝的交易, 并更新交易池
+	if bytes.Compare(prevTip, bc.GetCurrentHash()) != 0 {
+		cancelMining()
+		resetRejectedTxs()
+
+		// 区块直接连接在原最新区块之后, 只需删除已打包及冲突的交易; 否则(切换分叉链或连接了孤块)
+		// 先将被断开区块中的交易放回交易池, 再重新验证全部交易
+		if bytes.Compare(block.PrevBlockHash, prevTip) == 0 && bytes.Compare(block.Hash, bc.GetCurrentHash()) == 0 {
+			txPool.HandleConnectedBlock(block)
+		} else {
+			detachBlocks, err := bc.DisconnectedBlocks(prevTip)
+			if err != nil {
+				fmt.Printf("获取被断开的区块失败: %s\n", err)
+			}
+			txPool.HandleDisconnectedBlocks(detachBlocks)
+		}
+	}
+
 	// 判断当前存储的已有的区块是否>0
 	if len(blockInTransit) > 0 {
 		// 0号Hash表示节点的最后一个区块的Hash, 即最新的区块（区块的遍历是从后往前遍历）
@@ -178,9 +310,52 @@ func handleSendBlock(request []byte, bc *blockchain.Blockchain) {
 
 		// 更新当前节点已有区块Hash集合, 剔除已获取的区块
 		blockInTransit = blockInTransit[1:]
-	} else {
-		// 当前节点已获取全部区块, 则更新UTXO
-		set := blockchain.NewUTXOSet(bc)
-		set.Reindex()
 	}
-}
\ No newline at end of file
+}
+
+// 处理请求区块或交易数据的方法, 目前只处理交易, 区块通过getblock请求
+func handleGetData(request []byte) {
+	var payload GetData
+	var buff bytes.Buffer
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	// 根据交易ID从交易池中获取交易, 交易已被打包或淘汰时不发送
+	if payload.Type == "tx" {
+		tx, ok := txPool.FetchTransaction(payload.BlockHash)
+		if !ok {
+			fmt.Printf("交易池中不存在交易 %x\n", payload.BlockHash)
+			return
+		}
+
+		sendTx(payload.AddrFrom, tx)
+	}
+}
+
+// 处理外部节点发送的交易, 验证通过的交易放入交易池并向其他已知节点公告
+func handleTx(request []byte) {
+	var buff bytes.Buffer
+	var payload SendTx
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	tx := &payload.Transaction
+	_, err = txPool.MaybeAcceptTransaction(tx)
+	if err != nil {
+		fmt.Printf("拒绝交易 %x: %s\n", tx.ID, err)
+		markTxRejected(tx.ID, err)
+		return
+	}
+	markTxSeen(tx.ID)
+	fmt.Printf("交易 %x 已放入交易池, 当前交易数: %d\n", tx.ID, txPool.Count())
+
+	announceTransaction(tx, payload.AddrFrom)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"core/blockchain"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 挖矿失败(例如权威证明下未轮到当前节点)后等待多久重新开始挖矿
+const minerRetryInterval = time.Second
+
+// 当前挖矿任务的取消函数
+var miningCancel context.CancelFunc
+
+// 保护挖矿任务的锁
+var miningLock sync.Mutex
+
+// 开始一个新的挖矿任务, 返回可被取消的上下文, 之前未结束的挖矿任务会被取消
+func newMiningContext() context.Context {
+	miningLock.Lock()
+	defer miningLock.Unlock()
+
+	if miningCancel != nil {
+		miningCancel()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	miningCancel = cancel
+	return ctx
+}
+
+// 取消当前的挖矿任务, 在收到竞争区块导致最新区块变化时调用, 避免继续在旧区块上挖矿
+func cancelMining() {
+	miningLock.Lock()
+	defer miningLock.Unlock()
+
+	if miningCancel != nil {
+		miningCancel()
+		miningCancel = nil
+	}
+}
+
+/*
+	summary：矿工循环: 不断根据交易池中的交易构建区块模板并挖矿, coinbase交易将区块奖励与手续费支付给矿工地址
+	挖矿成功后将区块发送给全部已知节点; 最新区块变化时当前挖矿任务被取消, 在新的最新区块上重新构建模板
+	minerAddress: 矿工地址
+*/
+func startMiner(minerAddress string, bc *blockchain.Blockchain) {
+	for {
+		ctx := newMiningContext()
+		block, err := bc.MineBlockWithContext(ctx, minerAddress, txPool.SelectTransactions())
+		if err != nil {
+			switch err {
+			case blockchain.ErrMiningCanceled, blockchain.ErrStaleTip:
+				fmt.Println("最新区块已变化, 重新构建区块模板")
+			case blockchain.ErrNotInTurn:
+				waitRetry(ctx)
+			default:
+				// 交易池中的交易可能因最新区块变化而失效, 重新验证后再挖矿
+				fmt.Printf("挖矿失败: %s\n", err)
+				txPool.Revalidate()
+				waitRetry(ctx)
+			}
+			continue
+		}
+
+		fmt.Printf("挖矿成功, 高度: %d, 交易数: %d, Hash: %x\n", block.Height, len(block.Transactions), block.Hash)
+		txPool.HandleConnectedBlock(block)
+		resetRejectedTxs()
+
+		// 将新区块发送给全部已知节点
+		for _, node := range append([]string{}, knownNodes...) {
+			if node != nodeAddress {
+				sendBlock(node, block)
+			}
+		}
+	}
+}
+
+// 等待一段时间后重新挖矿, 期间最新区块变化时立即返回
+func waitRetry(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(minerRetryInterval):
+	}
+}
@@ -1,21 +1,44 @@
 package server
 
-// 发送区块信息的清单结构体
+import (
+	"core/blockchain"
+	"core/transaction"
+)
+
+// 发送区块或交易信息的清单结构体
 type Inventory struct {
 	AddrFrom string  // 请求的地址
-	Type string  // 类型
-	AllBlocksHash [][]byte  // 区块链所有区块的Hash
+	Type string  // 类型, block: 区块, tx: 交易
+	AllBlocksHash [][]byte  // 区块链所有区块的Hash, 类型为tx时为交易ID
 }
 
-// 请求区块的结构体
+// 请求区块或交易的结构体
 type GetData struct {
 	AddrFrom string  // 请求的地址
-	Type string  // 类型
-	BlockHash []byte  // 区块的Hash
+	Type string  // 类型, block: 区块, tx: 交易
+	BlockHash []byte  // 区块的Hash, 类型为tx时为交易ID
+}
+
+// 请求区块头的结构体
+type GetHeaders struct {
+	AddrFrom string  // 请求的地址
+	StartHash []byte  // 请求节点已有的最后一个区块(头)的Hash, 返回主链上该区块之后的区块头
+}
+
+// 发送区块头的结构体
+type Headers struct {
+	AddrFrom string  // 发往的地址
+	Headers []*blockchain.BlockHeader  // 从前往后排列的区块头
 }
 
 // 发送区块信息的结构体
 type SendBlock struct {
 	AddrFrom string  // 发往的地址
 	Block []byte  // 区块的序列化
-}
\ No newline at end of file
+}
+
+// 发送交易信息的结构体
+type SendTx struct {
+	AddrFrom string  // 发往的地址
+	Transaction transaction.Transaction  // 交易
+}
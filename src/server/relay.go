@@ -0,0 +1,113 @@
+/*
+  交易转发：通过交易清单向其他节点公告交易，其他节点按需请求交易数据，验证通过的交易放入交易池并继续向已知节点公告
+*/
+package server
+
+import (
+	"core/chaincfg"
+	"core/mempool"
+	"core/transaction"
+	"encoding/hex"
+	"sync"
+)
+
+// 最多记录的已见过的交易数量, 超过时清空重新记录
+const maxSeenTxs = 10000
+
+// 节点的交易池, 存放其他节点转发及本地创建的未打包交易
+var txPool *mempool.TxPool
+
+// 保护已见过的交易集合
+var seenTxsLock sync.Mutex
+
+// 已见过的交易 key: 交易ID的16进制字符串, 已放入交易池的交易不会重复请求及转发
+var seenTxs = make(map[string]bool)
+
+// 判断交易是否已见过
+func haveSeenTx(txID []byte) bool {
+	seenTxsLock.Lock()
+	defer seenTxsLock.Unlock()
+
+	return seenTxs[hex.EncodeToString(txID)]
+}
+
+// 记录交易已见过, 只在交易通过验证放入交易池后记录, 以免获取或验证暂时失败的交易不再被请求
+func markTxSeen(txID []byte) {
+	seenTxsLock.Lock()
+	defer seenTxsLock.Unlock()
+
+	if len(seenTxs) >= maxSeenTxs {
+		seenTxs = make(map[string]bool)
+	}
+
+	seenTxs[hex.EncodeToString(txID)] = true
+}
+
+// 最多记录的最近被拒绝的交易数量, 超过时清空重新记录
+const maxRejectedTxs = 10000
+
+// 保护最近被拒绝的交易集合
+var rejectedTxsLock sync.Mutex
+
+// 最近被拒绝的交易 key: 交易ID的16进制字符串, 不会重复请求; 最新区块变化时清空, 因区块链状态被拒绝的交易可以重新请求
+var rejectedTxs = make(map[string]bool)
+
+// 判断交易最近是否被拒绝过
+func haveRejectedTx(txID []byte) bool {
+	rejectedTxsLock.Lock()
+	defer rejectedTxsLock.Unlock()
+
+	return rejectedTxs[hex.EncodeToString(txID)]
+}
+
+/*
+	summary：根据交易池拒绝交易的原因记录被拒绝的交易, 以下情况不记录:
+	缺少输入(父交易可能稍后到达)、交易池已满(交易池有空间后可能接受)、交易ID与内容不一致(记录会使同一ID的有效交易被拒绝),
+	以及不是交易规则错误的其他错误
+*/
+func markTxRejected(txID []byte, err error) {
+	ruleErr, ok := err.(mempool.TxRuleError)
+	if !ok {
+		return
+	}
+
+	switch ruleErr.ErrorCode {
+	case mempool.ErrMissingInputs, mempool.ErrPoolFull, mempool.ErrBadTxID:
+		return
+	}
+
+	rejectedTxsLock.Lock()
+	defer rejectedTxsLock.Unlock()
+
+	if len(rejectedTxs) >= maxRejectedTxs {
+		rejectedTxs = make(map[string]bool)
+	}
+
+	rejectedTxs[hex.EncodeToString(txID)] = true
+}
+
+// 清空最近被拒绝的交易, 最新区块变化时调用
+func resetRejectedTxs() {
+	rejectedTxsLock.Lock()
+	defer rejectedTxsLock.Unlock()
+
+	rejectedTxs = make(map[string]bool)
+}
+
+// 向除来源节点及当前节点以外的全部已知节点公告交易
+func announceTransaction(tx *transaction.Transaction, addrFrom string) {
+	for _, node := range append([]string{}, knownNodes...) {
+		if node != nodeAddress && node != addrFrom {
+			sendInventory(node, "tx", [][]byte{tx.ID})
+		}
+	}
+}
+
+/*
+	summary：将本地创建的交易发送给网络的中心节点(第一个种子节点), 由中心节点放入交易池并转发给其他节点
+	params: 交易所属网络的参数, 决定消息的网络魔数及中心节点
+*/
+func SendTransaction(params *chaincfg.Params, tx *transaction.Transaction) {
+	chainParams = params
+	sendTx(params.Seeds[0], tx)
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"bytes"
 	"core/blockchain"
+	"core/transaction"
 	"fmt"
 	"io"
 	"log"
@@ -12,10 +13,10 @@ import (
 
 // 发送区块链的版本信息
 func sendVersion(address string, bc *blockchain.Blockchain) {
-	bestHeight := bc.GetBestHeight()
+	bestWork := bc.GetBestWork()
 
 	// 构建待发送的版本信息结构体
-	version := Version{nodeVersion, bestHeight, nodeAddress}
+	version := Version{chainParams.ProtocolVersion, bestWork.Bytes(), bc.TimeSource().Now().Unix(), nodeAddress}
 
 	// 序列化版本结构体
 	payload := utils.EncodeData(version)
@@ -42,6 +43,27 @@ func senGetBlockData(address, kind string, blockHash []byte) {
 	sendData(address, request)
 }
 
+// 发送请求获取区块或交易数据
+func sendGetData(address, kind string, hash []byte) {
+	payload := utils.EncodeData(GetData {nodeAddress, kind, hash})
+	request := append(commandToBytes("getdata"), payload...)
+	sendData(address, request)
+}
+
+// 发送请求获取区块头
+func sendGetHeaders(address string, startHash []byte) {
+	payload := utils.EncodeData(GetHeaders{nodeAddress, startHash})
+	request := append(commandToBytes("getheaders"), payload...)
+	sendData(address, request)
+}
+
+// 发送区块头
+func sendHeaders(address string, headers []*blockchain.BlockHeader) {
+	payload := utils.EncodeData(Headers{nodeAddress, headers})
+	request := append(commandToBytes("headers"), payload...)
+	sendData(address, request)
+}
+
 // 发送区块链清单
 func sendInventory(address string, kind string, allBlocksHash [][]byte) {
 	inventory := Inventory {nodeAddress, kind, allBlocksHash}
@@ -58,8 +80,18 @@ func sendBlock(address string, block *blockchain.Block) {
 	sendData(address, request)
 }
 
-// 根据地址发送数据
+// 发送交易信息
+func sendTx(address string, tx *transaction.Transaction) {
+	data := SendTx{nodeAddress, *tx}
+	payload := utils.EncodeData(data)
+	request := append(commandToBytes("tx"), payload...)
+	sendData(address, request)
+}
+
+// 根据地址发送数据, 数据前加上当前网络的魔数
 func sendData(address string, data []byte) {
+	data = append(networkMagic(), data...)
+
 	// 与address建立连接
 	conn, err := net.Dial("tcp", address)
 	if err != nil {
@@ -74,6 +106,7 @@ func sendData(address string, data []byte) {
 		}
 
 		knownNodes = updateNodeAddress
+		return
 	}
 
 	defer conn.Close()
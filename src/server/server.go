@@ -2,6 +2,8 @@ package server
 
 import (
 	"core/blockchain"
+	"core/chaincfg"
+	"core/mempool"
 	"fmt"
 	"log"
 	"net"
@@ -10,17 +12,36 @@ import (
 // 请求命令长度
 const commandLength = 20
 
-// 节点版本
-const nodeVersion = 0x00
+// 请求开头的网络魔数长度
+const magicLength = 4
+
+// 单个请求的最大字节数, 需要能容纳一个最大的区块
+const maxMessageSize = blockchain.MaxBlockSize * 2
+
+// 发送区块请求中除区块以外的数据(命令、发送地址及gob编码的类型信息等开销)最多占用的字节数
+const sendBlockOverhead = 1024
+
+// 节点所属网络的参数
+var chainParams *chaincfg.Params
 
 // 本地节点地址
 var nodeAddress string
 
 // 已知节点
-var knownNodes = []string{"localhost:3000"}
+var knownNodes []string
+
+/*
+	summary：开启服务器
+	params: 节点所属网络的参数, 决定消息的网络魔数、默认端口及种子节点
+	nodeId: 节点端口
+	minerAddress: 矿工地址, 不为空时节点持续挖矿
+*/
+func StrartServer(params *chaincfg.Params, nodeId, minerAddress string, bc *blockchain.Blockchain) {
+	chainParams = params
+
+	// 已知节点初始为网络的种子节点
+	knownNodes = append([]string{}, params.Seeds...)
 
-// 开启服务器
-func StrartServer(nodeId, minerAddress string, bc *blockchain.Blockchain) {
 	// 当前节点地址
 	nodeAddress = fmt.Sprintf("localhost:%s", nodeId)
 
@@ -34,10 +55,18 @@ func StrartServer(nodeId, minerAddress string, bc *blockchain.Blockchain) {
 
 	// 如果区块链不存在构建区块链对象
 	if bc == nil {
-		bc = blockchain.NewBlockchain("1FdsuGae3QNWcJLg2yKNQ1vZkZ5Cdg3KUm")
+		bc = blockchain.NewBlockchain(params)
+	}
+
+	// 构建节点的交易池
+	txPool = mempool.NewTxPool(bc, mempool.DefaultConfig())
+
+	// 设置了矿工地址时启动矿工循环
+	if minerAddress != "" {
+		go startMiner(minerAddress, bc)
 	}
 
-	if nodeAddress != knownNodes[0] {
+	if len(knownNodes) > 0 && nodeAddress != knownNodes[0] {
 		// 向外部节点发送当前节点的区块链版本信息
 		sendVersion(knownNodes[0], bc)
 	}
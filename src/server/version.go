@@ -1,15 +1,21 @@
 package server
 
-import "fmt"
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
 
 type Version struct {
 	Version int32
-	BestHeight int32
+	BestWork []byte  // 区块链最新区块的累计工作量
+	Timestamp int64  // 发送节点的当前时间, 用于计算网络调整时间
 	AddrFrom string  // 发送地址
 }
 
 func (ver *Version) String() {
 	fmt.Printf("当前区块的版本是: %d\n", ver.Version)
-	fmt.Printf("当前区块高度是: %d\n", ver.BestHeight)
+	fmt.Printf("当前区块链累计工作量是: %s\n", new(big.Int).SetBytes(ver.BestWork).String())
+	fmt.Printf("发送节点的当前时间是: %s\n", time.Unix(ver.Timestamp, 0).String())
 	fmt.Printf("发送当前信息的地址是: %s\n", ver.AddrFrom)
 }
\ No newline at end of file
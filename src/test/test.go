@@ -5,9 +5,16 @@ package test
 
 import (
 	"core/blockchain"
+	"core/chaincfg"
+	"core/script"
 	"core/transaction"
 	"core/wallet"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"testing"
+	"time"
+	"utils"
 )
 
 // 测试创建区块的默克尔根
@@ -24,11 +31,11 @@ func TestCreateMerkleTreeRoot() {
 		Height:         0,
 	}
 
-	txIn1 := transaction.TXInput{[]byte{}, -1, nil, nil}
-	txOut1 := transaction.NewTXOutput(transaction.Subsidy, "first")
+	txIn1 := transaction.TXInput{[]byte{}, -1, nil}
+	txOut1 := transaction.NewTXOutput(transaction.GetBlockSubsidy(&chaincfg.MainNetParams, 0), "first")
 	tx1 := transaction.Transaction{nil, []transaction.TXInput{txIn1 }, []transaction.TXOutput{*txOut1 }}
 
-	txIn2 := transaction.TXInput{[]byte{}, -1, nil,nil}
+	txIn2 := transaction.TXInput{[]byte{}, -1, nil}
 	txOut2 := transaction.NewTXOutput(100, "second")
 	tx2 := transaction.Transaction{nil, []transaction.TXInput{txIn2 }, []transaction.TXOutput{*txOut2 }}
 
@@ -47,7 +54,7 @@ func TestPow() {
 		MerkleRoot:    []byte{},
 		Hash:          []byte{},
 		Time:          1418755780,
-		Bits:          404454260,
+		Bits:          chaincfg.MainNetParams.PowLimitBits,
 		Nonce:         0,
 		Height:         0,
 		Transactions:  []*transaction.Transaction{},
@@ -62,6 +69,15 @@ func TestPow() {
 	fmt.Println("POW验证是否成功：", pow.Validate())
 }
 
+// 测试难度值的压缩格式编码与解码
+func TestCompactBits() {
+	for _, bits := range []uint32{0x181b7b74, 0x1f010000, 0x207fffff, 0x01003456, 0x04923456, 0xff123456} {
+		target, negative, overflow := utils.CompactToBig(bits)
+		fmt.Printf("Bits: %08x, 目标值: %x, 负数: %t, 溢出: %t, 重新编码: %08x\n",
+			bits, target, negative, overflow, utils.BigToCompact(target))
+	}
+}
+
 // 区块序列化测试
 func TestNewSerialize() {
 	// 初始化区块
@@ -87,24 +103,155 @@ func TestNewSerialize() {
 }
 
 func TestNewGensisBlock() {
-	blockchain.NewGensisBlock([]*transaction.Transaction{})
+	blockchain.NewGensisBlock(&chaincfg.MainNetParams)
 }
 
 // 测试区块链存储数据库
 func TestBoltDB() {
-	blockchain := blockchain.NewBlockchain("1FdsuGae3QNWcJLg2yKNQ1vZkZ5Cdg3KUm")
-	blockchain.MineBlock([]*transaction.Transaction{})
-	blockchain.MineBlock([]*transaction.Transaction{})
+	blockchain := blockchain.NewBlockchain(&chaincfg.MainNetParams)
+	blockchain.MineBlock("1FdsuGae3QNWcJLg2yKNQ1vZkZ5Cdg3KUm", []*transaction.Transaction{})
+	blockchain.MineBlock("1FdsuGae3QNWcJLg2yKNQ1vZkZ5Cdg3KUm", []*transaction.Transaction{})
 	blockchain.PrintBlockchain()
 }
 
 // 验证钱包功能
 func TestWallet() {
 	newWallet := wallet.NewWallet()
-	address := newWallet.GetAddress()
+	address := newWallet.GetAddress(&chaincfg.MainNetParams)
 
 	fmt.Printf("钱包私钥: %x\n", newWallet.PrivateKey.D.Bytes())
 	fmt.Printf("钱包公钥: %x\n", newWallet.PublicKey)
 	fmt.Printf("钱包地址: %x\n", address)
-	fmt.Printf("地址是否有效: %d\n", wallet.ValidateAddress(address))
-}
\ No newline at end of file
+	fmt.Printf("地址是否有效: %d\n", wallet.ValidateAddress(&chaincfg.MainNetParams, address))
+}
+
+// 验证不同网络的地址互不通用
+func TestNetworkAddress() {
+	newWallet := wallet.NewWallet()
+	networks := []*chaincfg.Params{&chaincfg.MainNetParams, &chaincfg.TestNetParams, &chaincfg.RegtestParams}
+	for _, params := range networks {
+		address := newWallet.GetAddress(params)
+		for _, other := range networks {
+			fmt.Printf("%s 地址 %s 在 %s 网络是否有效: %t\n", params.Name, address, other.Name, wallet.ValidateAddress(other, address))
+		}
+	}
+}
+
+// 测试区块奖励减半及累计发行量
+func TestSubsidy() {
+	heights := []int32{0, 999, 1000, 1999, 2000, 10000, 100000}
+	for _, height := range heights {
+		fmt.Printf("高度: %d, 区块奖励: %d, 累计发行量: %d\n", height, transaction.GetBlockSubsidy(&chaincfg.MainNetParams, height), transaction.GetTotalSupply(&chaincfg.MainNetParams, height))
+	}
+}
+
+// 固定时间的时钟, 用于测试网络调整时间
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+// 测试网络调整时间
+func TestMedianTimeSource() {
+	clock := fixedClock{time.Unix(1600000000, 0)}
+	timeSource := blockchain.NewMedianTimeSource(clock)
+
+	// 其他节点的时间分别快 10、20、30 秒, 加上本地时间的中位数为快 20 秒
+	timeSource.AddTimeSample("node1", clock.now.Add(10 * time.Second))
+	timeSource.AddTimeSample("node2", clock.now.Add(20 * time.Second))
+	timeSource.AddTimeSample("node3", clock.now.Add(30 * time.Second))
+	fmt.Printf("时间偏移: %s, 网络调整时间: %d\n", timeSource.Offset(), timeSource.AdjustedTime().Unix())
+
+	// 偏移的中位数超过70分钟时不调整本地时间
+	timeSource = blockchain.NewMedianTimeSource(clock)
+	timeSource.AddTimeSample("node1", clock.now.Add(2 * time.Hour))
+	timeSource.AddTimeSample("node2", clock.now.Add(3 * time.Hour))
+	fmt.Printf("时间偏移: %s, 网络调整时间: %d\n", timeSource.Offset(), timeSource.AdjustedTime().Unix())
+}
+
+// 比较不同工作量证明哈希算法的速度, scrypt和Argon2id每次hash需要占用大量内存, 速度远低于双重SHA256
+func TestPowHashBenchmark() {
+	header := []byte("这是用于测试工作量证明哈希算法速度的区块头")
+
+	scryptParams := chaincfg.CommunityNetParams
+	argon2Params := chaincfg.CommunityNetParams
+	argon2Params.PowAlgorithm = chaincfg.PowArgon2id
+	argon2Params.PowArgon2 = chaincfg.Argon2Params{Time: 1, Memory: 64 * 1024, Threads: 1}
+
+	for _, params := range []*chaincfg.Params{&chaincfg.MainNetParams, &scryptParams, &argon2Params} {
+		powHash, err := blockchain.NewPowHashFunc(params)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+
+		result := testing.Benchmark(func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				powHash(header)
+			}
+		})
+		fmt.Printf("算法: %s, 每次hash耗时: %d ns, 每秒hash次数: %.0f\n", params.PowAlgorithm, result.NsPerOp(), 1e9 / float64(result.NsPerOp()))
+	}
+}
+
+// 测试脚本: 支付到公钥Hash的交易签名验证, 以及需要提供原像的哈希锁定脚本
+func TestScript() {
+	// 前一交易的输出锁定到钱包地址
+	w := wallet.NewWallet()
+	address := string(w.GetAddress(&chaincfg.MainNetParams))
+	prevTx := transaction.NewCoinBaseTx(address, "script test", 50)
+	fmt.Printf("锁定脚本: %s\n", script.DisasmString(prevTx.Vout[0].ScriptPubKey))
+
+	tx := transaction.Transaction{nil, []transaction.TXInput{{prevTx.ID, 0, nil}}, []transaction.TXOutput{*transaction.NewTXOutput(50, address)}}
+	prevTXs := map[string]transaction.Transaction{hex.EncodeToString(prevTx.ID): *prevTx}
+	tx.Sign(w.PrivateKey, prevTXs)
+	fmt.Printf("解锁脚本: %s\n", script.DisasmString(tx.Vin[0].ScriptSig))
+	fmt.Printf("签名验证: %t\n", tx.Verify(prevTXs))
+
+	// 修改交易的输出后签名失效
+	tx.Vout[0].Value = 49
+	fmt.Printf("修改输出后签名验证: %t\n", tx.Verify(prevTXs))
+
+	// 哈希锁定: OP_IF OP_SHA256 <Hash> OP_EQUAL OP_ELSE OP_0 OP_ENDIF, 走OP_IF分支时需要提供原像
+	preimage := []byte("secret")
+	hash := sha256.Sum256(preimage)
+	lockScript, _ := script.NewScriptBuilder().AddOp(script.OP_IF).AddOp(script.OP_SHA256).AddData(hash[:]).
+		AddOp(script.OP_EQUAL).AddOp(script.OP_ELSE).AddOp(script.OP_0).AddOp(script.OP_ENDIF).Script()
+	fmt.Printf("哈希锁定脚本: %s\n", script.DisasmString(lockScript))
+
+	for _, guess := range []string{"secret", "guess"} {
+		unlockScript, _ := script.NewScriptBuilder().AddData([]byte(guess)).AddInt64(1).Script()
+		fmt.Printf("原像 %s 验证结果: %v\n", guess, script.Verify(unlockScript, lockScript, nil))
+	}
+}
+
+// 测试2-of-3多重签名: 签名数量不足时交易无效, 两个钱包依次签名后交易有效
+func TestMultiSig() {
+	params := &chaincfg.MainNetParams
+	w1, w2, w3 := wallet.NewWallet(), wallet.NewWallet(), wallet.NewWallet()
+	redeemScript, err := script.MultiSigScript(2, [][]byte{w1.PublicKey, w2.PublicKey, w3.PublicKey})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	address := string(wallet.ScriptHashAddress(params, script.Hash160(redeemScript)))
+	fmt.Printf("多重签名地址: %s, 地址是否有效: %t\n", address, wallet.ValidateAddress(params, []byte(address)))
+
+	prevTx := transaction.NewCoinBaseTx(address, "multisig test", 50)
+	fmt.Printf("锁定脚本: %s\n", script.DisasmString(prevTx.Vout[0].ScriptPubKey))
+
+	input, _ := transaction.NewMultiSigTXInput(prevTx.ID, 0, redeemScript)
+	tx := transaction.Transaction{nil, []transaction.TXInput{input}, []transaction.TXOutput{*transaction.NewTXOutput(50, string(w1.GetAddress(params)))}}
+	prevTXs := map[string]transaction.Transaction{hex.EncodeToString(prevTx.ID): *prevTx}
+
+	for i, w := range []*wallet.Wallet{w3, w1, w2} {
+		fmt.Printf("第 %d 个钱包签名结果: %v, 签名验证: %t\n", i + 1, tx.SignMultiSig(w.PrivateKey), tx.Verify(prevTXs))
+	}
+
+	// 赎回脚本为2-of-3多重签名, 花费时按3个签名操作计算
+	fmt.Printf("签名操作数量: %d, 赎回脚本签名操作数量: %d\n", tx.SigOpCount(), tx.P2SHSigOpCount(prevTXs))
+}
@@ -7,10 +7,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/gob"
-	"encoding/hex"
-	"fmt"
 	"log"
-	"strconv"
+	"math/big"
 )
 
 // 计算两个数的最小值M
@@ -38,6 +36,14 @@ func IntToHex(num int32, isLittle bool) []byte {
 	return buff.Bytes()
 }
 
+// 将大整数转为固定长度的字节数组, 不足长度前面补0
+func PaddedBytes(num *big.Int, length int) []byte {
+	result := make([]byte, length)
+	numBytes := num.Bytes()
+	copy(result[length-len(numBytes):], numBytes)
+	return result
+}
+
 // 字节翻转
 func ReverseBytes(data []byte) {
 	for i, j := 0, len(data) - 1; i < j; i, j = i + 1, j - 1 {
@@ -47,29 +53,85 @@ func ReverseBytes(data []byte) {
 
 // 计算目标值，当前区块的hash值必须小于目标值
 func CalculateTargetFast(nBits int32) []byte {
-	// 大端
-	bits := IntToHex(nBits, false)
+	// 解码压缩格式的难度值，负数或溢出的目标值无效，返回全0（任何hash值都无法满足）
+	target, negative, overflow := CompactToBig(uint32(nBits))
+	if negative || overflow {
+		return make([]byte, 32)
+	}
+
+	// 目标值保持32位，不足32位前面补0
+	return PaddedBytes(target, 32)
+}
 
-	// Bits难度，第一个字节表示指数
-	exponent := bits[:1]
-	fmt.Printf("%x\n", exponent)
+/*
+	summary：将压缩格式的难度值（Bits）解码为目标值
+	compact: 压缩格式的难度值，第一个字节表示指数，后面3个字节表示系数（系数的最高位为符号位）
+	return: 目标值；目标值是否为负数；目标值是否溢出（超过256位）
+*/
+func CompactToBig(compact uint32) (*big.Int, bool, bool) {
+	// 指数表示目标值的字节长度
+	exponent := uint(compact >> 24)
+	// 系数去掉最高位的符号位
+	mantissa := compact & 0x007fffff
+
+	target := new(big.Int)
+	if exponent <= 3 {
+		// 指数不足3个字节时，系数需要右移
+		mantissa >>= 8 * (3 - exponent)
+		target.SetInt64(int64(mantissa))
+	} else {
+		// 目标值 = 系数 * 256^(指数-3)
+		target.SetInt64(int64(mantissa))
+		target.Lsh(target, 8*(exponent-3))
+	}
 
-	// Bits后面3个字节表示系数
-	coeffient := bits[1:]
-	fmt.Printf("%x\n", coeffient)
+	// 系数不为0且符号位为1，表示负数
+	negative := mantissa != 0 && compact&0x00800000 != 0
 
-	// 将字节数组转为int，可先将字节数组转为string，再将string转为int
-	// 将字节的16进制为0x18，转为了string"18"
-	strExponent := hex.EncodeToString(exponent)
-	// 将字符串"18"转为了10进制int64 24
-	nExp, _ := strconv.ParseInt(strExponent, 16, 8)
+	// 系数不为0且目标值超过32个字节，表示溢出
+	overflow := mantissa != 0 && (exponent > 34 ||
+		(mantissa > 0xff && exponent > 33) ||
+		(mantissa > 0xffff && exponent > 32))
 
-	// 在系数前面加上32-nExp个0
-	result := append(bytes.Repeat([]byte{0x00}, 32-int(nExp)), coeffient...)
+	if negative {
+		target.Neg(target)
+	}
 
-	// 为了让result保持32位，若不足32位后面补0
-	result = append(result, bytes.Repeat([]byte{0x00}, 32-len(result))...)
-	return result
+	return target, negative, overflow
+}
+
+// 将目标值编码为压缩格式的难度值（Bits）
+func BigToCompact(target *big.Int) uint32 {
+	if target.Sign() == 0 {
+		return 0
+	}
+
+	// 取目标值的绝对值, 符号单独记录在符号位
+	abs := new(big.Int).Abs(target)
+
+	// 指数为目标值的字节长度
+	exponent := uint(len(abs.Bytes()))
+
+	// 系数取目标值最高的3个字节
+	var mantissa uint32
+	if exponent <= 3 {
+		mantissa = uint32(abs.Uint64()) << (8 * (3 - exponent))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(abs, 8*(exponent-3)).Uint64())
+	}
+
+	// 系数的最高位会被当作符号位，若为1则将系数右移一个字节，并将指数加1
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	compact := uint32(exponent<<24) | mantissa
+	if target.Sign() < 0 {
+		compact |= 0x00800000
+	}
+
+	return compact
 }
 
 // 序列化数据